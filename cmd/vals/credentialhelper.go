@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/helmfile/vals"
+)
+
+const (
+	// CredentialHelperPrefix is the prefix of the executable names that make vals run as a Docker credential helper,
+	// like docker-credential-vals.
+	CredentialHelperPrefix = "docker-credential-"
+
+	// EnvCredentialHelperConfig overrides the path of the configuration of the credential helper.
+	EnvCredentialHelperConfig = "VALS_CREDENTIAL_HELPER_CONFIG"
+)
+
+// errCredentialsNotFound has the message that Docker expects from credential helpers
+// when they have no credentials for a registry.
+var errCredentialsNotFound = errors.New("credentials not found in native keychain")
+
+// CredentialHelperConfig maps registry hostnames to the refs of their credentials.
+type CredentialHelperConfig struct {
+	Registries map[string]RegistryCredentials `yaml:"registries"`
+}
+
+// RegistryCredentials are the refs, or plain values, of the credentials of a registry.
+type RegistryCredentials struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// DefaultCredentialHelperConfigPath returns $VALS_CREDENTIAL_HELPER_CONFIG,
+// or credential-helper.yaml in the vals directory of the user configuration directory.
+func DefaultCredentialHelperConfigPath() string {
+	if p := os.Getenv(EnvCredentialHelperConfig); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "vals", "credential-helper.yaml")
+}
+
+// LoadCredentialHelperConfig reads a CredentialHelperConfig from a YAML file.
+func LoadCredentialHelperConfig(path string) (*CredentialHelperConfig, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no configuration file: set %s", EnvCredentialHelperConfig)
+	}
+
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c CredentialHelperConfig
+	if err := yaml.Unmarshal(bs, &c); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// lookup returns the credentials of the registry of serverURL, which is either a hostname or a URL like https://index.docker.io/v1/.
+func (c *CredentialHelperConfig) lookup(serverURL string) (RegistryCredentials, bool) {
+	host := registryHost(serverURL)
+	for k, creds := range c.Registries {
+		if registryHost(k) == host {
+			return creds, true
+		}
+	}
+	return RegistryCredentials{}, false
+}
+
+// registryHost returns the hostname, and port if any, of a registry, with the aliases of Docker Hub
+// normalized to index.docker.io as used by Docker.
+func registryHost(s string) string {
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	host := s
+	if u, err := url.Parse(s); err == nil {
+		host = u.Host
+	}
+	host = strings.ToLower(host)
+
+	switch host {
+	case "docker.io", "registry-1.docker.io":
+		return "index.docker.io"
+	}
+	return host
+}
+
+// CredentialHelper implements the get and list actions of the Docker credential helper protocol,
+// resolving the refs of the credentials of the configured registries.
+// store and erase are not supported, as the credentials are managed in the backends of the refs.
+func CredentialHelper(action string, in io.Reader, out io.Writer, config *CredentialHelperConfig, opts vals.Options) error {
+	switch action {
+	case "get", "list":
+	case "store", "erase":
+		return fmt.Errorf("%s is not supported: credentials are managed in the backends of the refs", action)
+	default:
+		return fmt.Errorf("unknown action %q: expected get or list", action)
+	}
+
+	runtime, err := vals.New(opts)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = runtime.Close() }()
+
+	if action == "list" {
+		keys := make([]string, 0, len(config.Registries))
+		for k := range config.Registries {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		res := make(map[string]string, len(keys))
+		for _, k := range keys {
+			username, err := runtime.Get(config.Registries[k].Username)
+			if err != nil {
+				return fmt.Errorf("%s: username: %w", k, err)
+			}
+			res[k] = username
+		}
+		return json.NewEncoder(out).Encode(res)
+	}
+
+	serverURL, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	serverURL = strings.TrimSpace(serverURL)
+
+	creds, ok := config.lookup(serverURL)
+	if !ok {
+		return errCredentialsNotFound
+	}
+
+	username, err := runtime.Get(creds.Username)
+	if err != nil {
+		return fmt.Errorf("%s: username: %w", serverURL, err)
+	}
+	password, err := runtime.Get(creds.Password)
+	if err != nil {
+		return fmt.Errorf("%s: password: %w", serverURL, err)
+	}
+
+	return json.NewEncoder(out).Encode(struct {
+		ServerURL string
+		Username  string
+		Secret    string
+	}{
+		ServerURL: serverURL,
+		Username:  username,
+		Secret:    password,
+	})
+}
+
+// runCredentialHelper runs the credential helper, and exits like Docker expects on error:
+// with the error message on stdout and exit code 1.
+func runCredentialHelper(action, configPath string, opts vals.Options) {
+	err := func() error {
+		config, err := LoadCredentialHelperConfig(configPath)
+		if err != nil {
+			return err
+		}
+		return CredentialHelper(action, os.Stdin, os.Stdout, config, opts)
+	}()
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stdout, err)
+		os.Exit(1)
+	}
+}
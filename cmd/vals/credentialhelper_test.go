@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/helmfile/vals"
+)
+
+func TestCredentialHelper(t *testing.T) {
+	config := &CredentialHelperConfig{
+		Registries: map[string]RegistryCredentials{
+			"docker.io": {
+				Username: "ref+echo://creds/hub#/creds",
+				Password: "ref+echo://hub-token",
+			},
+			"registry.example.com:5000": {
+				Username: "ci",
+				Password: "ref+echo://example-token",
+			},
+		},
+	}
+
+	testCases := []struct {
+		action   string
+		in       string
+		expected string
+		err      string
+	}{
+		{
+			action:   "get",
+			in:       "https://index.docker.io/v1/\n",
+			expected: `{"ServerURL":"https://index.docker.io/v1/","Username":"hub","Secret":"hub-token"}` + "\n",
+		},
+		{
+			action:   "get",
+			in:       "registry.example.com:5000",
+			expected: `{"ServerURL":"registry.example.com:5000","Username":"ci","Secret":"example-token"}` + "\n",
+		},
+		{
+			action: "get",
+			in:     "ghcr.io\n",
+			err:    "credentials not found in native keychain",
+		},
+		{
+			action:   "list",
+			expected: `{"docker.io":"hub","registry.example.com:5000":"ci"}` + "\n",
+		},
+		{
+			action: "store",
+			err:    "store is not supported: credentials are managed in the backends of the refs",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.action+" "+tc.in, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			err := CredentialHelper(tc.action, strings.NewReader(tc.in), out, config, vals.Options{})
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("unexpected error: expected=%s, got=%v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.String() != tc.expected {
+				t.Errorf("unexpected out: expected=%s, got=%s", tc.expected, out.String())
+			}
+		})
+	}
+}
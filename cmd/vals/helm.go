@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/helmfile/vals"
+	"github.com/helmfile/vals/pkg/providers/registry"
+)
+
+// HelmProtocolPrefix prefixes the schemes of refs in the URLs handled by the Helm downloader plugin,
+// like vals+file://values.yaml or vals+vault://secret/data/values#/yaml.
+const HelmProtocolPrefix = "vals+"
+
+// HelmPlugin is the plugin.yaml of a Helm plugin.
+type HelmPlugin struct {
+	Name        string           `yaml:"name"`
+	Version     string           `yaml:"version"`
+	Usage       string           `yaml:"usage"`
+	Description string           `yaml:"description"`
+	Downloaders []HelmDownloader `yaml:"downloaders"`
+}
+
+// HelmDownloader declares the command that Helm runs to download the URLs of the protocols.
+type HelmDownloader struct {
+	Command   string   `yaml:"command"`
+	Protocols []string `yaml:"protocols"`
+}
+
+// WriteHelmPluginYAML writes the plugin.yaml installing vals as a Helm downloader plugin,
+// for all the providers available in this build.
+// command is the vals executable, relative to the directory of the plugin.
+func WriteHelmPluginYAML(w io.Writer, command, version string) error {
+	if version == "" {
+		version = "0.0.0-dev"
+	}
+
+	var protocols []string
+	for _, p := range registry.Providers() {
+		protocols = append(protocols, HelmProtocolPrefix+p.Scheme)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(HelmPlugin{
+		Name:        "vals",
+		Version:     strings.TrimPrefix(version, "v"),
+		Usage:       "Resolve vals refs in values files, like helm install -f vals+file://values.yaml",
+		Description: "Evaluates values files and refs passed as vals+<scheme>://... with vals",
+		Downloaders: []HelmDownloader{{
+			Command:   command + " helm-downloader",
+			Protocols: protocols,
+		}},
+	}); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// HelmDownload implements the Helm downloader plugin contract: it writes the evaluated YAML denoted by the URL to out.
+//
+// vals+file://path/to/values.yaml reads the file, or all the files in the directory, relative to the working directory.
+// Any other vals+<scheme>://... is a ref whose value is a YAML document.
+// In both cases, the refs in the documents are resolved too.
+func HelmDownload(url string, out io.Writer, opts vals.Options) error {
+	if !strings.HasPrefix(url, HelmProtocolPrefix) {
+		return fmt.Errorf("unsupported URL %q: expected %s<scheme>://...", url, HelmProtocolPrefix)
+	}
+	ref := strings.TrimPrefix(url, HelmProtocolPrefix)
+
+	runtime, err := vals.New(opts)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = runtime.Close() }()
+
+	var nodes []yaml.Node
+	if path, ok := strings.CutPrefix(ref, vals.ProviderFile+"://"); ok {
+		nodes, err = vals.Inputs(path)
+		if err != nil {
+			return err
+		}
+	} else {
+		doc, err := runtime.Get("ref+" + ref)
+		if err != nil {
+			return err
+		}
+		nodes, err = vals.NodesFromReader(strings.NewReader(doc))
+		if err != nil {
+			return fmt.Errorf("reading the value of %s as YAML: %w", ref, err)
+		}
+		for _, n := range nodes {
+			if len(n.Content) == 0 || n.Content[0].Kind != yaml.MappingNode {
+				return fmt.Errorf("the value of %s is not a YAML map", ref)
+			}
+		}
+	}
+
+	res, err := runtime.EvalNodes(nodes)
+	if err != nil {
+		return err
+	}
+
+	return vals.Output(out, vals.FormatYAML, res)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/helmfile/vals"
+)
+
+func TestHelmDownload(t *testing.T) {
+	dir := t.TempDir()
+	values := filepath.Join(dir, "values.yaml")
+	if err := os.WriteFile(values, []byte("a: ref+echo://foo/bar#/foo\nb: 1\nrelease: 2024-01-01\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		url      string
+		expected string
+		err      string
+	}{
+		{
+			url:      "vals+file://" + values,
+			expected: "a: bar\nb: 1\nrelease: \"2024-01-01\"\n",
+		},
+		{
+			// The value of the ref is itself evaluated.
+			url:      "vals+exec://cat?args=" + values,
+			expected: "a: bar\nb: 1\nrelease: \"2024-01-01\"\n",
+		},
+		{
+			url: "vals+echo://foo",
+			err: "the value of echo://foo is not a YAML map",
+		},
+		{
+			url: "https://example.com/values.yaml",
+			err: `unsupported URL "https://example.com/values.yaml": expected vals+<scheme>://...`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			err := HelmDownload(tc.url, out, vals.Options{})
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("unexpected error: expected=%s, got=%v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.String() != tc.expected {
+				t.Errorf("unexpected out: expected=%s, got=%s", tc.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestWriteHelmPluginYAML(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := WriteHelmPluginYAML(out, "bin/vals", "v1.2.3"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"name: vals\n", "version: 1.2.3\n", "  - command: bin/vals helm-downloader\n", "      - vals+file\n", "      - vals+vault\n"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected %q in:\n%s", s, out.String())
+		}
+	}
+}
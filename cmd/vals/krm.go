@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/helmfile/vals"
+)
+
+// KRMConfig are the options of "vals krm", read from the functionConfig of the ResourceList.
+// They are either the data of a ConfigMap, or the spec of any other kind of resource.
+type KRMConfig struct {
+	ExcludeSecret           bool   `yaml:"excludeSecret"`
+	FailOnMissingKeyInMap   bool   `yaml:"failOnMissingKeyInMap"`
+	DecodeKubernetesSecrets bool   `yaml:"decodeKubernetesSecrets"`
+	Policy                  string `yaml:"policy"`
+}
+
+// KRMResult is an entry of the results of a ResourceList.
+type KRMResult struct {
+	Message     string       `yaml:"message"`
+	Severity    string       `yaml:"severity"`
+	ResourceRef *ResourceRef `yaml:"resourceRef,omitempty"`
+}
+
+// ResourceRef identifies the item of a ResourceList that a KRMResult is about.
+type ResourceRef struct {
+	APIVersion string `yaml:"apiVersion,omitempty"`
+	Kind       string `yaml:"kind,omitempty"`
+	Name       string `yaml:"name,omitempty"`
+	Namespace  string `yaml:"namespace,omitempty"`
+}
+
+// KRM implements the KRM function specification: it reads a ResourceList from in,
+// replaces the ref expressions in its items, and writes the ResourceList to out.
+// Errors are also reported in the results of the ResourceList, and make KRM return an error
+// once the ResourceList has been written, so that kustomize shows them and fails the build.
+func KRM(in io.Reader, out io.Writer, logOut io.Writer) error {
+	nodes, err := vals.NodesFromReader(in)
+	if err != nil {
+		return fmt.Errorf("reading ResourceList: %w", err)
+	}
+	if len(nodes) == 0 {
+		return errors.New("reading ResourceList: expected a map")
+	}
+	doc := nodes[0]
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return errors.New("reading ResourceList: expected a map")
+	}
+	list := doc.Content[0]
+
+	if kind := mappingValue(list, "kind"); kind == nil || kind.Value != "ResourceList" {
+		return errors.New("reading ResourceList: expected kind ResourceList")
+	}
+
+	var results []KRMResult
+
+	config, err := readKRMConfig(mappingValue(list, "functionConfig"))
+	if err != nil {
+		results = append(results, KRMResult{Message: err.Error(), Severity: "error"})
+	}
+
+	var items []*yaml.Node
+	if n := mappingValue(list, "items"); n != nil && n.Kind == yaml.SequenceNode {
+		items = n.Content
+	}
+
+	if err == nil {
+		results = append(results, evalKRMItems(items, config, logOut)...)
+	}
+
+	if len(results) > 0 {
+		var resultsNode yaml.Node
+		if err := resultsNode.Encode(results); err != nil {
+			return err
+		}
+		// The results of the functions run earlier in the pipeline are kept.
+		if prev := mappingValue(list, "results"); prev != nil && prev.Kind == yaml.SequenceNode {
+			prev.Content = append(prev.Content, resultsNode.Content...)
+		} else {
+			setMappingValue(list, "results", &resultsNode)
+		}
+	}
+
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	if len(results) > 0 {
+		return fmt.Errorf("%d error(s) reported in the results of the ResourceList", len(results))
+	}
+	return nil
+}
+
+// evalKRMItems replaces the ref expressions in items in place, using a single runtime
+// so that values are fetched once across items, and returns an error result per failing item.
+func evalKRMItems(items []*yaml.Node, config KRMConfig, logOut io.Writer) []KRMResult {
+	opts := vals.Options{
+		ExcludeSecret:         config.ExcludeSecret,
+		FailOnMissingKeyInMap: config.FailOnMissingKeyInMap,
+		LogOutput:             logOut,
+	}
+	if config.Policy != "" {
+		p, err := vals.LoadPolicy(config.Policy)
+		if err != nil {
+			return []KRMResult{{Message: err.Error(), Severity: "error"}}
+		}
+		opts.Policy = p
+	}
+
+	runtime, err := vals.New(opts)
+	if err != nil {
+		return []KRMResult{{Message: err.Error(), Severity: "error"}}
+	}
+	defer func() { _ = runtime.Close() }()
+
+	var results []KRMResult
+	for _, item := range items {
+		if err := evalKRMItem(runtime, item, config); err != nil {
+			results = append(results, KRMResult{
+				Message:     err.Error(),
+				Severity:    "error",
+				ResourceRef: resourceRefOf(item),
+			})
+		}
+	}
+	return results
+}
+
+func evalKRMItem(runtime *vals.Runtime, item *yaml.Node, config KRMConfig) error {
+	if item.Kind != yaml.MappingNode {
+		return fmt.Errorf("unexpected item: expected a map")
+	}
+
+	// KsDecode modifies values in place, which must not leak into the item when the evaluation fails.
+	node := yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{copyNode(item)}}
+
+	// Only Secrets with base64-encoded data need to be decoded and encoded back.
+	// Those with stringData only are left as they are.
+	encoded := config.DecodeKubernetesSecrets && mappingValue(item, "data") != nil
+	if encoded {
+		n, err := KsDecode(node)
+		if err != nil {
+			return fmt.Errorf("decoding secret: %w", err)
+		}
+		node = *n
+	}
+
+	res, err := runtime.EvalNodes([]yaml.Node{node})
+	if err != nil {
+		return err
+	}
+	node = res[0]
+
+	if encoded {
+		n, err := KsEncode(node)
+		if err != nil {
+			return fmt.Errorf("encoding secret: %w", err)
+		}
+		node = *n
+	}
+
+	*item = *node.Content[0]
+	return nil
+}
+
+func readKRMConfig(fc *yaml.Node) (KRMConfig, error) {
+	config := KRMConfig{
+		FailOnMissingKeyInMap:   true,
+		DecodeKubernetesSecrets: true,
+	}
+	if fc == nil || fc.Kind != yaml.MappingNode {
+		return config, nil
+	}
+
+	if kind := mappingValue(fc, "kind"); kind != nil && kind.Value == "ConfigMap" {
+		data := map[string]string{}
+		if n := mappingValue(fc, "data"); n != nil {
+			if err := n.Decode(&data); err != nil {
+				return config, fmt.Errorf("reading functionConfig: %w", err)
+			}
+		}
+		for k, v := range data {
+			var err error
+			switch k {
+			case "excludeSecret":
+				config.ExcludeSecret, err = strconv.ParseBool(v)
+			case "failOnMissingKeyInMap":
+				config.FailOnMissingKeyInMap, err = strconv.ParseBool(v)
+			case "decodeKubernetesSecrets":
+				config.DecodeKubernetesSecrets, err = strconv.ParseBool(v)
+			case "policy":
+				config.Policy = v
+			default:
+				err = errors.New("unknown option")
+			}
+			if err != nil {
+				return config, fmt.Errorf("reading functionConfig: %s: %w", k, err)
+			}
+		}
+		return config, nil
+	}
+
+	if n := mappingValue(fc, "spec"); n != nil {
+		if err := n.Decode(&config); err != nil {
+			return config, fmt.Errorf("reading functionConfig: %w", err)
+		}
+	}
+	return config, nil
+}
+
+func resourceRefOf(item *yaml.Node) *ResourceRef {
+	value := func(n *yaml.Node, key string) string {
+		if v := mappingValue(n, key); v != nil {
+			return v.Value
+		}
+		return ""
+	}
+
+	ref := &ResourceRef{
+		APIVersion: value(item, "apiVersion"),
+		Kind:       value(item, "kind"),
+	}
+	if md := mappingValue(item, "metadata"); md != nil {
+		ref.Name = value(md, "name")
+		ref.Namespace = value(md, "namespace")
+	}
+	return ref
+}
+
+// mappingValue returns the value of key in the mapping node n, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func setMappingValue(n *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content[i+1] = value
+			return
+		}
+	}
+	n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+func copyNode(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = copyNode(child)
+	}
+	return &c
+}
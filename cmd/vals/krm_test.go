@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestKRM(t *testing.T) {
+	in := `apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: creds
+  data:
+    password: cmVmK2VjaG86Ly9zM2NyM3Q=
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: config
+    annotations:
+      config.kubernetes.io/path: config.yaml
+  data:
+    user: ref+echo://admin
+    release: 2024-01-01
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: broken
+    namespace: ns
+  data:
+    user: ref+echo://foo/bar#/baz
+functionConfig:
+  apiVersion: v1
+  kind: ConfigMap
+  data:
+    failOnMissingKeyInMap: "true"
+results:
+- message: reported by an earlier function
+  severity: warning
+`
+	outExpected := `apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+  - apiVersion: v1
+    kind: Secret
+    metadata:
+      name: creds
+    data:
+      password: czNjcjN0
+  - apiVersion: v1
+    data:
+      release: "2024-01-01"
+      user: admin
+    kind: ConfigMap
+    metadata:
+      annotations:
+        config.kubernetes.io/path: config.yaml
+      name: config
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: broken
+      namespace: ns
+    data:
+      user: ref+echo://foo/bar#/baz
+functionConfig:
+  apiVersion: v1
+  kind: ConfigMap
+  data:
+    failOnMissingKeyInMap: "true"
+results:
+  - message: reported by an earlier function
+    severity: warning
+  - message: 'expand echo://foo/bar#/baz: no value found for key baz'
+    severity: error
+    resourceRef:
+      apiVersion: v1
+      kind: ConfigMap
+      name: broken
+      namespace: ns
+`
+
+	out := &bytes.Buffer{}
+	err := KRM(strings.NewReader(in), out, io.Discard)
+	if err == nil || err.Error() != "1 error(s) reported in the results of the ResourceList" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if outActual := out.String(); outActual != outExpected {
+		t.Errorf("unexpected out: expected=%s, got=%s", outExpected, outActual)
+	}
+}
+
+func TestKRM_SpecConfig(t *testing.T) {
+	in := `apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: config
+  data:
+    a: ref+echo://foo/bar#/baz
+    b: secretref+echo://secret
+functionConfig:
+  apiVersion: vals.helmfile.dev/v1alpha1
+  kind: Vals
+  spec:
+    excludeSecret: true
+    failOnMissingKeyInMap: false
+`
+	out := &bytes.Buffer{}
+	if err := KRM(strings.NewReader(in), out, io.Discard); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if outActual := out.String(); !strings.Contains(outActual, "b: secretref+echo://secret\n") || strings.Contains(outActual, "results:") {
+		t.Errorf("unexpected out: %s", outActual)
+	}
+}
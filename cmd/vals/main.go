@@ -1,15 +1,23 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 
 	"gopkg.in/yaml.v3"
 
 	"github.com/helmfile/vals"
+	"github.com/helmfile/vals/pkg/providers/registry"
+	"github.com/helmfile/vals/pkg/server"
 )
 
 var (
@@ -24,11 +32,19 @@ Usage:
   vals [command]
 
 Available Commands:
-  eval		Evaluate a JSON/YAML document and replace any template expressions in it and prints the result
+  eval		Evaluate a JSON/YAML/TOML/HCL/dotenv document and replace any template expressions in it and prints the result
   exec		Populates the environment variables and executes the command
   env		Renders environment variables to be consumed by eval or a tool like direnv
   flatten	Read any text file and resolve ref+ expressions in it, preserving the original format
   get		Evaluate a string value passed as the first argument and replace any expressions in it and prints the result
+  template	Render a Go template file whose "ref" and "refMap" functions fetch values
+  lint		Validate ref+ expressions found in files without contacting any backend
+  providers	List the providers available in this build, or describe the parameters of one
+  serve		Serve evaluations on a unix socket or over mutual TLS, reusing provider clients and caches across invocations
+  krm		Run as a KRM function, resolving refs in the items of a ResourceList read from STDIN, like in "kustomize build"
+  helm-downloader	Print the values file or ref denoted by a vals+<scheme>://... URL, evaluated, as a Helm downloader plugin
+  tf-external	Resolve the refs in a JSON object read from STDIN, as a program of the Terraform external data source
+  credential-helper	Serve registry credentials resolved from refs, as a Docker credential helper
   ksdecode	Decode YAML document(s) by converting Secret resources' "data" to "stringData" for use with "vals eval"
   version	Print vals version
 
@@ -38,6 +54,18 @@ Use "vals [command] --help" for more information about a command
 	fmt.Fprintf(os.Stderr, "%s\n", text)
 }
 
+// stringSlice is a flag.Value for flags that can be specified multiple times.
+type stringSlice []string
+
+func (s *stringSlice) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSlice) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
 func fatal(format string, args ...interface{}) {
 	fmt.Fprintf(os.Stderr, format+"\n", args...)
 	os.Exit(1)
@@ -64,6 +92,66 @@ func readOrFail(f *string) map[string]interface{} {
 	return nodeValue
 }
 
+// loadPolicyOrFail reads the policy file, returning nil when no file is given.
+func loadPolicyOrFail(path string) *vals.Policy {
+	if path == "" {
+		return nil
+	}
+	p, err := vals.LoadPolicy(path)
+	if err != nil {
+		fatal("%v", err)
+	}
+	return p
+}
+
+// recursionConfig holds the flags defined by recursionFlags.
+type recursionConfig struct {
+	recursive bool
+	depth     int
+}
+
+// recursionFlags defines the flags of the commands that can resolve the refs found in the values fetched by refs.
+func recursionFlags(fs *flag.FlagSet) *recursionConfig {
+	var c recursionConfig
+	fs.BoolVar(&c.recursive, "recursive-refs", false, "Resolve the ref+ expressions found in the values fetched by refs, like a shared config pointing at per-environment secrets")
+	fs.IntVar(&c.depth, "recursion-depth", vals.DefaultRecursionDepth, "How many levels of refs found in fetched values are resolved with -recursive-refs. 1 resolves the refs in the values fetched by the refs of the input, and fails on any ref found further")
+	return &c
+}
+
+// envConfigFlags defines the flags of the commands that turn nested maps and lists into environment variables.
+func envConfigFlags(fs *flag.FlagSet) *vals.EnvConfig {
+	var c vals.EnvConfig
+	fs.StringVar(&c.Separator, "flatten-separator", "_", "Separator used to join the keys of nested maps and the indices of lists into environment variable names, like DB_HOST and ITEMS_0")
+	fs.StringVar(&c.Case, "key-case", "", "Change the case of environment variable names to either \"upper\" or \"lower\". They are left as is by default")
+	fs.BoolVar(&c.JSONValues, "json-values", false, "Pass top-level maps and lists as JSON, instead of flattening them")
+	return &c
+}
+
+// writeOutputFile writes the evaluated documents of the file at rel to the same path relative to dir,
+// readable only by the current user as they contain secrets.
+func writeOutputFile(dir, rel, format string, nodes []yaml.Node, config vals.OutputConfig) error {
+	path := filepath.Join(dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	fp, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = fp.Close() }()
+
+	// The permissions of existing files are tightened too.
+	if err := fp.Chmod(0o600); err != nil {
+		return err
+	}
+
+	if err := vals.Output(fp, format, nodes, config); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return fp.Close()
+}
+
 func writeOrFail(o *string, nodes []yaml.Node) {
 	err := vals.Output(os.Stdout, *o, nodes)
 	if err != nil {
@@ -79,9 +167,29 @@ func main() {
 	CmdGet := "get"
 	CmdExec := "exec"
 	CmdEnv := "env"
+	CmdTemplate := "template"
+	CmdLint := "lint"
+	CmdProviders := "providers"
+	CmdServe := "serve"
+	CmdKRM := "krm"
+	CmdHelmDownloader := "helm-downloader"
+	CmdTFExternal := "tf-external"
+	CmdCredentialHelper := "credential-helper"
 	CmdKsDecode := "ksdecode"
 	CmdVersion := "version"
 
+	// Docker runs credential helpers as docker-credential-<name> <action>, without flags.
+	if strings.HasPrefix(filepath.Base(os.Args[0]), CredentialHelperPrefix) {
+		if len(os.Args) != 2 {
+			fatal("Expected a single argument, which is the action: get or list")
+		}
+		runCredentialHelper(os.Args[1], DefaultCredentialHelperConfigPath(), vals.Options{
+			LogOutput:             io.Discard,
+			FailOnMissingKeyInMap: true,
+		})
+		return
+	}
+
 	if len(os.Args) == 1 {
 		flag.Usage()
 		return
@@ -90,11 +198,21 @@ func main() {
 	switch os.Args[1] {
 	case CmdEval:
 		evalCmd := flag.NewFlagSet(CmdEval, flag.ExitOnError)
-		f := evalCmd.String("f", "-", "YAML/JSON file to be evaluated. When set to \"-\", vals reads from STDIN")
-		o := evalCmd.String("o", "yaml", "Output type which is either \"yaml\" or \"json\"")
+		f := evalCmd.String("f", "-", "YAML/JSON/TOML/HCL/dotenv file to be evaluated. When set to \"-\", vals reads from STDIN")
+		i := evalCmd.String("i", "", "Input format which is one of \"yaml\", \"json\", \"json5\", \"toml\", \"hcl\" or \"dotenv\". Detected from the file extension when omitted")
+		o := evalCmd.String("o", "", "Output type which is one of \"yaml\", \"json\", \"json5\", \"toml\", \"hcl\", \"tfvars\", \"dotenv\" or \"properties\". Defaults to the input format for json5, toml, hcl and dotenv, and to \"yaml\" otherwise")
+		separator := evalCmd.String("flatten-separator", "", "Separator used to join the keys of nested maps and lists for flat output formats. Defaults to \"_\" for dotenv and \".\" for properties")
 		silent := evalCmd.Bool("s", false, "Silent mode")
 		e := evalCmd.Bool("exclude-secret", false, "Leave secretref+<uri> as-is and only replace ref+<uri>")
 		k := evalCmd.Bool("decode-kubernetes-secrets", false, "Decode Kubernetes secrets before evaluate them, then encode it again.")
+		policy := evalCmd.String("policy", "", "YAML file restricting the providers, commands, files and hosts that refs can use")
+		serverAddr := evalCmd.String("server", os.Getenv(EnvServer), "Address of a \"vals serve\" server to delegate the evaluation to, either unix:///path/to/socket or https://host:port. Defaults to $VALS_SERVER")
+		var include, exclude stringSlice
+		evalCmd.Var(&include, "include", "Glob pattern of the files to read when -f is a directory, like \"*.yaml\". A pattern with a slash matches the path relative to the directory. Can be specified multiple times")
+		evalCmd.Var(&exclude, "exclude", "Glob pattern of the files and directories to skip when -f is a directory, matched like -include. Can be specified multiple times")
+		recursive := evalCmd.Bool("recursive", true, "Read the files in the subdirectories too when -f is a directory")
+		outputDir := evalCmd.String("output-dir", "", "Write each evaluated file to the same path relative to this directory, in its own format, instead of concatenating all the documents to STDOUT")
+		recursion := recursionFlags(evalCmd)
 		failOnMissingKeyInMap := evalCmd.Bool("fail-on-missing-key-in-map", true, "When set to false, the vals-eval command exits with code 0 even when the key denoted by the #/key/for/value/in/the/json/or/yaml does not exist in the decoded map")
 		err := evalCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -106,50 +224,165 @@ func main() {
 			logOut = io.Discard
 		}
 
-		nodes := readNodesOrFail(f)
+		inputs := vals.InputsConfig{
+			Format:    *i,
+			Include:   include,
+			Exclude:   exclude,
+			Recursive: *recursive,
+		}
 
-		if *k {
-			var res []yaml.Node
-			for _, node := range nodes {
-				n, err := KsDecode(node)
+		var files []vals.InputFile
+		if *f != "-" {
+			if info, err := os.Stat(*f); err == nil && info.IsDir() {
+				files, err = vals.InputFiles(*f, inputs)
 				if err != nil {
-					fatal("error on decoding secrets: %v", err)
+					fatal("%v", err)
 				}
-				res = append(res, *n)
 			}
+		}
 
-			nodes = res
+		var runtime *vals.Runtime
+		var evalNodes func([]yaml.Node) ([]yaml.Node, error)
+		if c := serverClientOrFail(*serverAddr, *policy); c != nil {
+			evalNodes = func(nodes []yaml.Node) ([]yaml.Node, error) {
+				return c.EvalNodes(nodes, vals.Options{
+					ExcludeSecret:         *e,
+					FailOnMissingKeyInMap: *failOnMissingKeyInMap,
+					Recursive:             recursion.recursive,
+					RecursionDepth:        recursion.depth,
+				})
+			}
+		} else {
+			// A single runtime is shared by all the files, so that each ref is fetched once.
+			runtime, err = vals.New(vals.Options{
+				ExcludeSecret:         *e,
+				LogOutput:             logOut,
+				FailOnMissingKeyInMap: *failOnMissingKeyInMap,
+				Recursive:             recursion.recursive,
+				RecursionDepth:        recursion.depth,
+				Policy:                loadPolicyOrFail(*policy),
+			})
+			if err != nil {
+				fatal("%v", err)
+			}
+			defer func() { _ = runtime.Close() }()
+			evalNodes = runtime.EvalNodes
+		}
+
+		evalOrFail := func(nodes []yaml.Node) []yaml.Node {
+			if *k {
+				var res []yaml.Node
+				for _, node := range nodes {
+					n, err := KsDecode(node)
+					if err != nil {
+						fatal("error on decoding secrets: %v", err)
+					}
+					res = append(res, *n)
+				}
+
+				nodes = res
+			}
+
+			res, err := evalNodes(nodes)
+			if err != nil {
+				fatal("%v", err)
+			}
+
+			if *k {
+				var nodes []yaml.Node
+				for _, node := range res {
+					n, err := KsEncode(node)
+					if err != nil {
+						fatal("error on encoding secrets: %v", err)
+					}
+					nodes = append(nodes, *n)
+				}
+
+				res = nodes
+			}
+
+			return res
 		}
 
-		res, err := vals.EvalNodes(nodes, vals.Options{
-			ExcludeSecret:         *e,
-			LogOutput:             logOut,
-			FailOnMissingKeyInMap: *failOnMissingKeyInMap,
-		})
+		if *outputDir != "" {
+			if *f == "-" {
+				fatal("-output-dir requires -f to be a file or a directory")
+			}
+			if *o != "" {
+				fatal("-o cannot be combined with -output-dir, as each file is written in its own format")
+			}
+			if files == nil {
+				files, err = vals.InputFiles(*f, inputs)
+				if err != nil {
+					fatal("%v", err)
+				}
+			}
+
+			for _, file := range files {
+				if err := writeOutputFile(*outputDir, file.Path, file.Format, evalOrFail(file.Nodes), vals.OutputConfig{Separator: *separator}); err != nil {
+					fatal("%v", err)
+				}
+			}
+			return
+		}
 
-		if *k {
-			var nodes []yaml.Node
-			for _, node := range res {
-				n, err := KsEncode(node)
+		inputFormat := *i
+		if inputFormat == "" && *f != "-" {
+			inputFormat = vals.DetectFormat(*f)
+		}
+
+		if *o == "" {
+			switch inputFormat {
+			case vals.FormatJSON5, vals.FormatTOML, vals.FormatHCL, vals.FormatDotenv:
+				*o = inputFormat
+			default:
+				*o = vals.FormatYAML
+			}
+		}
+
+		// YAML is evaluated one document at a time, so that large multi-document inputs are written as they are evaluated.
+		streamable := inputFormat == "" || inputFormat == vals.FormatYAML || inputFormat == vals.FormatJSON
+		if files == nil && streamable && *o == vals.FormatYAML && !*k && runtime != nil {
+			in := os.Stdin
+			if *f != "-" {
+				fp, err := os.Open(*f)
 				if err != nil {
-					fatal("error on encoding secrets: %v", err)
+					fatal("%v", err)
 				}
-				nodes = append(nodes, *n)
+				defer func() { _ = fp.Close() }()
+				in = fp
 			}
 
-			res = nodes
+			if err := runtime.EvalStream(in, os.Stdout); err != nil {
+				fatal("%v", err)
+			}
+			return
 		}
 
-		if err != nil {
-			fatal("%v", err)
+		var nodes []yaml.Node
+		if files != nil {
+			for _, file := range files {
+				nodes = append(nodes, file.Nodes...)
+			}
+		} else {
+			nodes, err = vals.InputsFormat(*f, *i)
+			if err != nil {
+				fatal("%v", err)
+			}
 		}
 
-		writeOrFail(o, res)
+		if err := vals.Output(os.Stdout, *o, evalOrFail(nodes), vals.OutputConfig{Separator: *separator}); err != nil {
+			fatal("%v", err)
+		}
 	case CmdFlatten:
 		flattenCmd := flag.NewFlagSet(CmdFlatten, flag.ExitOnError)
 		f := flattenCmd.String("f", "-", "Text file to be flattened. When set to \"-\", vals reads from STDIN")
 		silent := flattenCmd.Bool("s", false, "Silent mode")
 		e := flattenCmd.Bool("exclude-secret", false, "Leave secretref+<uri> as-is and only replace ref+<uri>")
+		policy := flattenCmd.String("policy", "", "YAML file restricting the providers, commands, files and hosts that refs can use")
+		serverAddr := flattenCmd.String("server", os.Getenv(EnvServer), "Address of a \"vals serve\" server to delegate the evaluation to, either unix:///path/to/socket or https://host:port. Defaults to $VALS_SERVER")
+		recursion := recursionFlags(flattenCmd)
+		escape := flattenCmd.String("escape", "", "Escape each value for the syntax surrounding it, which is one of \"json\", \"yaml\", \"toml\", \"shell\" or \"xml\". When set to \"auto\", the syntax is detected from the file extension. Values are inserted verbatim when omitted")
 		err := flattenCmd.Parse(os.Args[2:])
 		if err != nil {
 			fatal("%v", err)
@@ -165,10 +398,26 @@ func main() {
 			fatal("%v", err)
 		}
 
-		result, err := vals.Get(text, vals.Options{
-			ExcludeSecret: *e,
-			LogOutput:     logOut,
-		})
+		if *escape == vals.EscapeAuto {
+			*escape = vals.DetectEscape(*f)
+		}
+
+		var result string
+		if c := serverClientOrFail(*serverAddr, *policy); c != nil {
+			result, err = c.Flatten(text, *escape, vals.Options{
+				ExcludeSecret:  *e,
+				Recursive:      recursion.recursive,
+				RecursionDepth: recursion.depth,
+			})
+		} else {
+			result, err = vals.Flatten(text, *escape, vals.Options{
+				ExcludeSecret:  *e,
+				LogOutput:      logOut,
+				Recursive:      recursion.recursive,
+				RecursionDepth: recursion.depth,
+				Policy:         loadPolicyOrFail(*policy),
+			})
+		}
 		if err != nil {
 			fatal("%v", err)
 		}
@@ -180,6 +429,9 @@ func main() {
 	case CmdGet:
 		getCmd := flag.NewFlagSet(CmdGet, flag.ExitOnError)
 		silent := getCmd.Bool("s", false, "Silent mode")
+		policy := getCmd.String("policy", "", "YAML file restricting the providers, commands, files and hosts that refs can use")
+		recursion := recursionFlags(getCmd)
+		serverAddr := getCmd.String("server", os.Getenv(EnvServer), "Address of a \"vals serve\" server to delegate the evaluation to, either unix:///path/to/socket or https://host:port. Defaults to $VALS_SERVER")
 		err := getCmd.Parse(os.Args[2:])
 		if err != nil {
 			fatal("%v", err)
@@ -195,7 +447,17 @@ func main() {
 			logOut = io.Discard
 		}
 
-		v, err := vals.Get(code, vals.Options{LogOutput: logOut})
+		var v string
+		if c := serverClientOrFail(*serverAddr, *policy); c != nil {
+			v, err = c.Get(code, vals.Options{Recursive: recursion.recursive, RecursionDepth: recursion.depth})
+		} else {
+			v, err = vals.Get(code, vals.Options{
+				LogOutput:      logOut,
+				Recursive:      recursion.recursive,
+				RecursionDepth: recursion.depth,
+				Policy:         loadPolicyOrFail(*policy),
+			})
+		}
 		if err != nil {
 			fatal("%v", err)
 		}
@@ -208,7 +470,15 @@ func main() {
 		execCmd := flag.NewFlagSet(CmdExec, flag.ExitOnError)
 		f := execCmd.String("f", "", "YAML/JSON file to be loaded to set envvars")
 		inheritEnv := execCmd.Bool("i", false, "Inherit environment variables")
+		resolveEnv := execCmd.Bool("resolve-env", false, "Inherit environment variables, resolving the ref+ expressions found in their values")
+		watchInterval := execCmd.Duration("watch-interval", 0, "Resolve the refs again at this interval, like 5m, and restart or signal the command when any value changed")
+		onChange := execCmd.String("on-change", vals.ExecOnChangeRestart, "What to do when values changed with -watch-interval: \"restart\" the command gracefully, or \"signal\" it after updating its files. It is restarted anyway when environment variables changed")
+		reloadSignal := execCmd.String("reload-signal", "HUP", "Signal sent to the command with -on-change signal")
+		envConfig := envConfigFlags(execCmd)
+		var files stringSlice
+		execCmd.Var(&files, "file", "KEY=ref+... writes the value of the ref to a private file, and sets $KEY to its path. Can be specified multiple times")
 		silent := execCmd.Bool("s", false, "Silent mode")
+		policy := execCmd.String("policy", "", "YAML file restricting the providers, commands, files and hosts that refs can use")
 		streamYAML := execCmd.String("stream-yaml", "", `Reads the specific YAML file or all the YAML files
 stored within the specific directory, evaluate each YAML file,
 joining all the YAML files with "---" lines, and stream the
@@ -229,15 +499,37 @@ the vals-eval outputs onto the disk, for security reasons.`)
 			m = map[string]interface{}{}
 		}
 
+		fileRefs := map[string]string{}
+		for _, f := range files {
+			k, v, ok := strings.Cut(f, "=")
+			if !ok {
+				fatal("Invalid -file %q: expected KEY=ref+...", f)
+			}
+			fileRefs[k] = v
+		}
+
+		if *onChange != vals.ExecOnChangeRestart && *onChange != vals.ExecOnChangeSignal {
+			fatal("Unsupported -on-change %q: must be either %q or %q", *onChange, vals.ExecOnChangeRestart, vals.ExecOnChangeSignal)
+		}
+		sig, err := parseSignal(*reloadSignal)
+		if err != nil {
+			fatal("%v", err)
+		}
+
 		var logOut io.Writer = os.Stderr
 		if *silent {
 			logOut = io.Discard
 		}
 
 		err = vals.Exec(m, execCmd.Args(), vals.ExecConfig{
-			InheritEnv: *inheritEnv,
-			Options:    vals.Options{LogOutput: logOut},
-			StreamYAML: *streamYAML,
+			Files:         fileRefs,
+			InheritEnv:    *inheritEnv,
+			ResolveEnv:    *resolveEnv,
+			Options:       vals.Options{LogOutput: logOut, Policy: loadPolicyOrFail(*policy), Env: *envConfig},
+			StreamYAML:    *streamYAML,
+			WatchInterval: *watchInterval,
+			OnChange:      *onChange,
+			ReloadSignal:  sig,
 		})
 		if err != nil {
 			fatal("%v", err)
@@ -245,7 +537,10 @@ the vals-eval outputs onto the disk, for security reasons.`)
 	case CmdEnv:
 		execEnv := flag.NewFlagSet(CmdEnv, flag.ExitOnError)
 		f := execEnv.String("f", "", "YAML/JSON file to be loaded to set envvars")
-		export := execEnv.Bool("export", false, "Prepend 'export' to each line")
+		export := execEnv.Bool("export", false, "Prepend 'export' to each line of the posix format")
+		format := execEnv.String("format", vals.EnvFormatPOSIX, "Output format which is one of "+strings.Join(vals.EnvFormats, ", ")+". github-actions appends the variables to $GITHUB_ENV, and prints ::add-mask:: commands for the secretref+ values")
+		envConfig := envConfigFlags(execEnv)
+		policy := execEnv.String("policy", "", "YAML file restricting the providers, commands, files and hosts that refs can use")
 		err := execEnv.Parse(os.Args[2:])
 		if err != nil {
 			fatal("%v", err)
@@ -253,16 +548,274 @@ the vals-eval outputs onto the disk, for security reasons.`)
 
 		m := readOrFail(f)
 
-		env, err := vals.QuotedEnv(m)
+		vars, err := vals.EnvVars(m, vals.Options{Policy: loadPolicyOrFail(*policy), Env: *envConfig})
+		if err != nil {
+			fatal("%v", err)
+		}
+
+		config := vals.EnvOutputConfig{Export: *export}
+		if *format == vals.EnvFormatGitHubActions {
+			path := os.Getenv("GITHUB_ENV")
+			if path == "" {
+				fatal("The github-actions format requires GITHUB_ENV to be set")
+			}
+			fp, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+			if err != nil {
+				fatal("%v", err)
+			}
+			defer func() { _ = fp.Close() }()
+			config.GitHubEnv = fp
+		}
+
+		if err := vals.WriteEnv(os.Stdout, *format, vars, config); err != nil {
+			fatal("%v", err)
+		}
+	case CmdTemplate:
+		templateCmd := flag.NewFlagSet(CmdTemplate, flag.ExitOnError)
+		f := templateCmd.String("f", "-", "Go text/template file to be rendered. When set to \"-\", vals reads from STDIN")
+		silent := templateCmd.Bool("s", false, "Silent mode")
+		e := templateCmd.Bool("exclude-secret", false, "Leave secretref+<uri> as-is and only replace ref+<uri>")
+		recursion := recursionFlags(templateCmd)
+		policy := templateCmd.String("policy", "", "YAML file restricting the providers, commands, files and hosts that refs can use")
+		err := templateCmd.Parse(os.Args[2:])
+		if err != nil {
+			fatal("%v", err)
+		}
+
+		var logOut io.Writer = os.Stderr
+		if *silent {
+			logOut = io.Discard
+		}
+
+		text, err := vals.TextInput(*f)
+		if err != nil {
+			fatal("%v", err)
+		}
+
+		err = vals.Template(os.Stdout, text, nil, vals.Options{
+			ExcludeSecret:  *e,
+			LogOutput:      logOut,
+			Recursive:      recursion.recursive,
+			RecursionDepth: recursion.depth,
+			Policy:         loadPolicyOrFail(*policy),
+		})
+		if err != nil {
+			fatal("%v", err)
+		}
+	case CmdLint:
+		lintCmd := flag.NewFlagSet(CmdLint, flag.ExitOnError)
+		var files stringSlice
+		lintCmd.Var(&files, "f", "File or directory to be linted. Can be specified multiple times, and files can also be passed as arguments")
+		err := lintCmd.Parse(os.Args[2:])
+		if err != nil {
+			fatal("%v", err)
+		}
+
+		files = append(files, lintCmd.Args()...)
+		if len(files) == 0 {
+			fatal("Nothing to lint: No file specified")
+		}
+
+		var issues int
+		for _, f := range files {
+			is, err := vals.LintFile(f)
+			if err != nil {
+				fatal("%v", err)
+			}
+			for _, i := range is {
+				_, _ = fmt.Fprintln(os.Stdout, i.String())
+			}
+			issues += len(is)
+		}
+
+		if issues > 0 {
+			fatal("%d problem(s) found", issues)
+		}
+	case CmdProviders:
+		providersCmd := flag.NewFlagSet(CmdProviders, flag.ExitOnError)
+		o := providersCmd.String("o", "table", "Output type which is either \"table\" or \"json\"")
+		err := providersCmd.Parse(os.Args[2:])
+		if err != nil {
+			fatal("%v", err)
+		}
+		if *o != "table" && *o != "json" {
+			fatal("Unsupported output type %q: must be either \"table\" or \"json\"", *o)
+		}
+
+		switch providersCmd.NArg() {
+		case 0:
+			providers := registry.Providers()
+			if *o == "json" {
+				err = WriteProvidersJSON(os.Stdout, providers)
+			} else {
+				err = WriteProviders(os.Stdout, providers)
+			}
+		case 1:
+			m, err := describeProvider(providersCmd.Arg(0))
+			if err != nil {
+				fatal("%v", err)
+			}
+			if *o == "json" {
+				err = WriteProvidersJSON(os.Stdout, m)
+			} else {
+				err = WriteProvider(os.Stdout, m)
+			}
+		default:
+			fatal("Too many arguments: expected at most one provider name")
+		}
+		if err != nil {
+			fatal("%v", err)
+		}
+	case CmdServe:
+		serveCmd := flag.NewFlagSet(CmdServe, flag.ExitOnError)
+		listen := serveCmd.String("listen", os.Getenv(EnvServer), "Address to listen on, either unix:///path/to/socket or https://host:port. Defaults to $VALS_SERVER")
+		tlsCert := serveCmd.String("tls-cert", "", "PEM certificate of the server. Required for https")
+		tlsKey := serveCmd.String("tls-key", "", "PEM private key of the server. Required for https")
+		tlsClientCA := serveCmd.String("tls-client-ca", "", "PEM bundle of the CAs that client certificates must be signed by. Required for https")
+		silent := serveCmd.Bool("s", false, "Silent mode")
+		policy := serveCmd.String("policy", "", "YAML file restricting the providers, commands, files and hosts that refs can use")
+		cacheTTL := serveCmd.Duration("cache-ttl", 0, "How long fetched values are cached before being fetched again, like 10m. Zero caches them until POST /v1/flush or a restart")
+		err := serveCmd.Parse(os.Args[2:])
+		if err != nil {
+			fatal("%v", err)
+		}
+		if *listen == "" {
+			fatal("Nothing to listen on: Set -listen or $%s", EnvServer)
+		}
+
+		var logOut io.Writer = os.Stderr
+		if *silent {
+			logOut = io.Discard
+		}
+
+		network, _, err := server.ParseAddress(*listen)
+		if err != nil {
+			fatal("%v", err)
+		}
+
+		var tlsConfig *tls.Config
+		if network != "unix" {
+			if *tlsCert == "" || *tlsKey == "" || *tlsClientCA == "" {
+				fatal("Serving over https requires -tls-cert, -tls-key and -tls-client-ca")
+			}
+			tlsConfig, err = server.ServerTLSConfig(*tlsCert, *tlsKey, *tlsClientCA)
+			if err != nil {
+				fatal("%v", err)
+			}
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		s := server.New(vals.Options{LogOutput: logOut, Policy: loadPolicyOrFail(*policy)})
+		s.CacheTTL = *cacheTTL
+		fmt.Fprintf(logOut, "vals: serving on %s\n", *listen)
+		err = s.ListenAndServe(ctx, *listen, tlsConfig)
+		if cerr := s.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fatal("%v", err)
+		}
+	case CmdKRM:
+		krmCmd := flag.NewFlagSet(CmdKRM, flag.ExitOnError)
+		silent := krmCmd.Bool("s", false, "Silent mode")
+		err := krmCmd.Parse(os.Args[2:])
 		if err != nil {
 			fatal("%v", err)
 		}
-		for _, l := range env {
-			if *export {
-				l = "export " + l
+
+		var logOut io.Writer = os.Stderr
+		if *silent {
+			logOut = io.Discard
+		}
+
+		if err := KRM(os.Stdin, os.Stdout, logOut); err != nil {
+			fatal("%v", err)
+		}
+	case CmdHelmDownloader:
+		helmCmd := flag.NewFlagSet(CmdHelmDownloader, flag.ExitOnError)
+		pluginYAML := helmCmd.Bool("plugin-yaml", false, "Print the plugin.yaml installing vals as a Helm downloader plugin, instead of downloading")
+		command := helmCmd.String("command", "vals", "Path to the vals executable relative to the directory of the Helm plugin, written to the plugin.yaml")
+		silent := helmCmd.Bool("s", false, "Silent mode")
+		policy := helmCmd.String("policy", "", "YAML file restricting the providers, commands, files and hosts that refs can use")
+		err := helmCmd.Parse(os.Args[2:])
+		if err != nil {
+			fatal("%v", err)
+		}
+
+		if *pluginYAML {
+			if err := WriteHelmPluginYAML(os.Stdout, *command, version); err != nil {
+				fatal("%v", err)
 			}
-			_, _ = fmt.Fprintln(os.Stdout, l)
+			return
+		}
+
+		// Helm passes the certificate, key and CA of the chart repository, which don't apply to providers.
+		if helmCmd.NArg() != 4 {
+			fatal("Expected 4 arguments, as passed by Helm: certFile keyFile caFile URL")
+		}
+
+		var logOut io.Writer = os.Stderr
+		if *silent {
+			logOut = io.Discard
+		}
+
+		err = HelmDownload(helmCmd.Arg(3), os.Stdout, vals.Options{
+			LogOutput:             logOut,
+			FailOnMissingKeyInMap: true,
+			Policy:                loadPolicyOrFail(*policy),
+		})
+		if err != nil {
+			fatal("%v", err)
+		}
+	case CmdTFExternal:
+		tfCmd := flag.NewFlagSet(CmdTFExternal, flag.ExitOnError)
+		silent := tfCmd.Bool("s", false, "Silent mode")
+		e := tfCmd.Bool("exclude-secret", false, "Leave secretref+<uri> as-is and only replace ref+<uri>")
+		policy := tfCmd.String("policy", "", "YAML file restricting the providers, commands, files and hosts that refs can use")
+		err := tfCmd.Parse(os.Args[2:])
+		if err != nil {
+			fatal("%v", err)
 		}
+
+		var logOut io.Writer = os.Stderr
+		if *silent {
+			logOut = io.Discard
+		}
+
+		err = TFExternal(os.Stdin, os.Stdout, vals.Options{
+			ExcludeSecret:         *e,
+			LogOutput:             logOut,
+			FailOnMissingKeyInMap: true,
+			Policy:                loadPolicyOrFail(*policy),
+		})
+		if err != nil {
+			fatal("%v", err)
+		}
+	case CmdCredentialHelper:
+		helperCmd := flag.NewFlagSet(CmdCredentialHelper, flag.ExitOnError)
+		config := helperCmd.String("config", DefaultCredentialHelperConfigPath(), "YAML file mapping registry hostnames to the refs of their username and password. Defaults to $VALS_CREDENTIAL_HELPER_CONFIG, or vals/credential-helper.yaml in the user configuration directory")
+		silent := helperCmd.Bool("s", false, "Silent mode")
+		policy := helperCmd.String("policy", "", "YAML file restricting the providers, commands, files and hosts that refs can use")
+		err := helperCmd.Parse(os.Args[2:])
+		if err != nil {
+			fatal("%v", err)
+		}
+		if helperCmd.NArg() != 1 {
+			fatal("Expected a single argument, which is the action: get or list")
+		}
+
+		var logOut io.Writer = os.Stderr
+		if *silent {
+			logOut = io.Discard
+		}
+
+		runCredentialHelper(helperCmd.Arg(0), *config, vals.Options{
+			LogOutput:             logOut,
+			FailOnMissingKeyInMap: true,
+			Policy:                loadPolicyOrFail(*policy),
+		})
 	case CmdKsDecode:
 		evalCmd := flag.NewFlagSet(CmdKsDecode, flag.ExitOnError)
 		f := evalCmd.String("f", "", "YAML/JSON file to be decoded")
@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/helmfile/vals/pkg/providers/registry"
 )
 
 func TestKsDecode(t *testing.T) {
@@ -77,3 +79,35 @@ kind: Secret
 		t.Errorf("unexpected out: expected=%s, got=%s", outExpected, outActual)
 	}
 }
+
+func TestWriteProvider(t *testing.T) {
+	m := registry.Metadata{
+		Scheme:      "example",
+		Description: "Example provider",
+		Params: []registry.Param{
+			{Name: "mode", Type: "enum", Values: []string{"a", "b"}, Default: "a", Description: "Mode"},
+			{Name: "token", Type: "string", Sensitive: true, Env: []string{"EXAMPLE_TOKEN"}, Description: "Token"},
+		},
+		Capabilities: registry.Capabilities{Fragment: true},
+	}
+
+	outExpected := `Scheme:       example
+Description:  Example provider
+Build tag:    -
+StringMap:    no
+Fragment:     yes
+Parameters:
+  NAME   TYPE       DEFAULT  REQUIRED  SENSITIVE  ENV                       DESCRIPTION
+  mode   enum(a|b)  a        no        no         VALS_MODE                 Mode
+  token  string     -        no        yes        VALS_TOKEN,EXAMPLE_TOKEN  Token
+`
+
+	buf := &bytes.Buffer{}
+	if err := WriteProvider(buf, m); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if outActual := buf.String(); outActual != outExpected {
+		t.Errorf("unexpected out: expected=%s, got=%s", outExpected, outActual)
+	}
+}
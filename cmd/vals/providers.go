@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/helmfile/vals"
+	"github.com/helmfile/vals/pkg/providers/plugin"
+	"github.com/helmfile/vals/pkg/providers/registry"
+)
+
+// describeProvider returns the metadata of the registered provider for the scheme,
+// or else of the vals-provider-<scheme> plugin, which is started to describe itself.
+func describeProvider(scheme string) (registry.Metadata, error) {
+	if _, ok := registry.GetProvider(scheme); ok {
+		m, ok := registry.Describe(scheme)
+		if !ok {
+			m = registry.Metadata{Scheme: scheme}
+		}
+		return m, nil
+	}
+
+	path, ok := plugin.Find(scheme, plugin.Dirs())
+	if !ok {
+		return registry.Metadata{}, fmt.Errorf("unknown provider %q: run \"vals providers\" to list the available ones", scheme)
+	}
+
+	c, err := plugin.Start(scheme, path, plugin.PermissionsFromEnv(scheme), nil)
+	if err != nil {
+		return registry.Metadata{}, err
+	}
+	defer func() { _ = c.Close() }()
+
+	return c.Describe(), nil
+}
+
+// WriteProviders prints the registered providers as a table, one provider per row.
+func WriteProviders(w io.Writer, providers []registry.Metadata) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "SCHEME\tSTRINGMAP\tFRAGMENT\tBUILD TAG\tDESCRIPTION")
+	for _, m := range providers {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", m.Scheme, yesNo(m.Capabilities.StringMap), yesNo(m.Capabilities.Fragment), orDash(m.BuildTag), m.Description)
+	}
+	return tw.Flush()
+}
+
+// WriteProvider prints the description, capabilities and parameters of the provider.
+func WriteProvider(w io.Writer, m registry.Metadata) error {
+	_, _ = fmt.Fprintf(w, "Scheme:       %s\n", m.Scheme)
+	_, _ = fmt.Fprintf(w, "Description:  %s\n", orDash(m.Description))
+	_, _ = fmt.Fprintf(w, "Build tag:    %s\n", orDash(m.BuildTag))
+	_, _ = fmt.Fprintf(w, "StringMap:    %s\n", yesNo(m.Capabilities.StringMap))
+	_, _ = fmt.Fprintf(w, "Fragment:     %s\n", yesNo(m.Capabilities.Fragment))
+
+	if len(m.Params) == 0 {
+		_, _ = fmt.Fprintln(w, "Parameters:   none")
+		return nil
+	}
+
+	_, _ = fmt.Fprintln(w, "Parameters:")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "  NAME\tTYPE\tDEFAULT\tREQUIRED\tSENSITIVE\tENV\tDESCRIPTION")
+	for _, p := range m.Params {
+		name := p.Name
+		if p.Prefix {
+			name += "<NAME>"
+		}
+		typ := p.Type
+		if len(p.Values) > 0 {
+			typ += "(" + strings.Join(p.Values, "|") + ")"
+		}
+		env := p.Env
+		if !p.Prefix {
+			env = append([]string{vals.EnvFallbackPrefix + strings.ToUpper(p.Name)}, env...)
+		}
+		_, _ = fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, typ, orDash(p.Default), yesNo(p.Required), yesNo(p.Sensitive), orDash(strings.Join(env, ",")), p.Description)
+	}
+	return tw.Flush()
+}
+
+// WriteProvidersJSON prints v, either a provider or a list of providers, as indented JSON.
+func WriteProvidersJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/tls"
+	"os"
+
+	"github.com/helmfile/vals/pkg/server"
+)
+
+const (
+	// EnvServer is the default address of the server for "vals serve" and the -server flag.
+	EnvServer = "VALS_SERVER"
+
+	// EnvServerTLSCert, EnvServerTLSKey and EnvServerTLSCA configure the client certificate,
+	// and the CA of the server, when delegating to a server over https.
+	EnvServerTLSCert = "VALS_SERVER_TLS_CERT"
+	EnvServerTLSKey  = "VALS_SERVER_TLS_KEY"
+	EnvServerTLSCA   = "VALS_SERVER_TLS_CA"
+)
+
+// serverClientOrFail returns a client for the server at addr, or nil when addr is empty.
+// Delegating to a server is exclusive with a local policy, as the policy of the server applies.
+func serverClientOrFail(addr, policy string) *server.Client {
+	if addr == "" {
+		return nil
+	}
+	if policy != "" {
+		fatal("The -policy flag cannot be used along with -server: the policy of the server applies")
+	}
+
+	network, _, err := server.ParseAddress(addr)
+	if err != nil {
+		fatal("%v", err)
+	}
+
+	var tlsConfig *tls.Config
+	if network != "unix" {
+		tlsConfig, err = server.ClientTLSConfig(os.Getenv(EnvServerTLSCert), os.Getenv(EnvServerTLSKey), os.Getenv(EnvServerTLSCA))
+		if err != nil {
+			fatal("Loading the TLS config from %s, %s and %s: %v", EnvServerTLSCert, EnvServerTLSKey, EnvServerTLSCA, err)
+		}
+	}
+
+	c, err := server.NewClient(addr, tlsConfig)
+	if err != nil {
+		fatal("%v", err)
+	}
+	return c
+}
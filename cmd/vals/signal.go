@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// signals maps the names accepted by -reload-signal to signals.
+var signals = map[string]os.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+}
+
+// parseSignal returns the signal named like HUP or SIGHUP.
+func parseSignal(name string) (os.Signal, error) {
+	if sig, ok := signals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]; ok {
+		return sig, nil
+	}
+
+	names := make([]string, 0, len(signals))
+	for n := range signals {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	return nil, fmt.Errorf("unsupported signal %q: expected one of %s", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/helmfile/vals"
+)
+
+// TFExternal implements the protocol of the Terraform external data source:
+// it reads the query, a JSON object of strings, from in, resolves the refs in each value,
+// and writes the result, a JSON object of strings, to out.
+// Values without refs are returned as they are.
+//
+// Nothing is written to out on error, and the returned error lists all the keys that failed,
+// so that Terraform shows them as a single diagnostic.
+func TFExternal(in io.Reader, out io.Writer, opts vals.Options) error {
+	var query map[string]string
+	if err := json.NewDecoder(in).Decode(&query); err != nil {
+		return fmt.Errorf("reading query: expected a JSON object of strings: %w", err)
+	}
+
+	runtime, err := vals.New(opts)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = runtime.Close() }()
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make(map[string]string, len(query))
+	var errs []error
+	for _, k := range keys {
+		v, err := runtime.Get(query[k])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", k, err))
+			continue
+		}
+		result[k] = v
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	return json.NewEncoder(out).Encode(result)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/helmfile/vals"
+)
+
+func TestTFExternal(t *testing.T) {
+	in := `{"password": "ref+echo://foo/bar#/foo", "url": "https://ref+echo://example.com+/path", "plain": "as-is"}`
+
+	out := &bytes.Buffer{}
+	if err := TFExternal(strings.NewReader(in), out, vals.Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	outExpected := `{"password":"bar","plain":"as-is","url":"https://example.com/path"}` + "\n"
+	if out.String() != outExpected {
+		t.Errorf("unexpected out: expected=%s, got=%s", outExpected, out.String())
+	}
+}
+
+func TestTFExternal_Errors(t *testing.T) {
+	testCases := []struct {
+		in  string
+		err string
+	}{
+		{
+			in:  `{"a": "ref+echo://foo/bar#/baz", "b": "ref+echo://foo/bar#/foo", "c": "ref+echo://foo/bar#/qux"}`,
+			err: "a: expand echo://foo/bar#/baz: no value found for key baz\nc: expand echo://foo/bar#/qux: no value found for key qux",
+		},
+		{
+			in:  `{"a": 1}`,
+			err: "reading query: expected a JSON object of strings: json: cannot unmarshal number into Go struct field .a of type string",
+		},
+	}
+
+	for _, tc := range testCases {
+		out := &bytes.Buffer{}
+		err := TFExternal(strings.NewReader(tc.in), out, vals.Options{FailOnMissingKeyInMap: true})
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("unexpected error: expected=%s, got=%v", tc.err, err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("unexpected out: %s", out.String())
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package vals
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/helmfile/vals/pkg/expansion"
+)
+
+// DecodeTag is the struct tag holding the default of a field, usually a ref like `vals:"ref+vault://kv/db#/password"`,
+// that is used when the input has no value for the field.
+const DecodeTag = "vals"
+
+// Decode reads a single YAML or JSON document from in, replaces its refs like Eval, and decodes the result into v,
+// which must be a pointer to a struct or a map.
+// in can be nil to only use the defaults in the struct tags, including those of nested structs.
+//
+// Fields are named after their yaml or json tags, or their lowercased names otherwise, like in yaml.v3.
+// The strings fetched by refs are converted to the types of the fields, like numbers, booleans,
+// time.Duration from strings like 5s, and types implementing encoding.TextUnmarshaler.
+// A string decoded into a slice is either a YAML or JSON list, or a comma-separated list.
+// The errors name the paths of the fields that failed to decode.
+func Decode(ctx context.Context, in io.Reader, v interface{}, opts Options) error {
+	runtime, err := New(opts)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = runtime.Close() }()
+	return runtime.Decode(ctx, in, v)
+}
+
+// Decode is like the package-level Decode, but shares the caches of the runtime.
+func (r *Runtime) Decode(ctx context.Context, in io.Reader, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("decode: expected a non-nil pointer, got %T", v)
+	}
+
+	doc := map[string]interface{}{}
+	if in != nil {
+		dec := yaml.NewDecoder(in)
+		var node yaml.Node
+		if err := dec.Decode(&node); err != nil && err != io.EOF {
+			return fmt.Errorf("decode: %w", err)
+		}
+		for {
+			var next yaml.Node
+			if err := dec.Decode(&next); err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("decode: %w", err)
+			}
+			if !isEmptyDocument(next) {
+				return errors.New("decode: expected a single document, but got more")
+			}
+		}
+		if len(node.Content) > 0 && !isEmptyDocument(node) {
+			replaceTimestamp(&node)
+			var m interface{}
+			if err := node.Decode(&m); err != nil {
+				return fmt.Errorf("decode: %w", err)
+			}
+			var ok bool
+			doc, ok = m.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("decode: expected a map, got %T", m)
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	res, err := r.Eval(doc)
+	if err != nil {
+		return err
+	}
+
+	expand, err := r.prepare()
+	if err != nil {
+		return err
+	}
+
+	d := &decoder{ctx: ctx, expand: expand}
+	if err := d.decode("", res, rv.Elem()); err != nil {
+		return err
+	}
+	return errors.Join(d.errs...)
+}
+
+// decoder decodes evaluated values into Go values, collecting the errors of all the fields.
+type decoder struct {
+	ctx    context.Context
+	expand *expansion.ExpandRegexMatch
+	errs   []error
+	// defaults counts the fields set from the vals tags.
+	defaults int
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// decode sets out to v. It returns an error only when the decoding must stop, like on cancellation,
+// and records the errors of the fields otherwise.
+func (d *decoder) decode(path string, v interface{}, out reflect.Value) error {
+	if err := d.ctx.Err(); err != nil {
+		return err
+	}
+
+	// A missing struct still gets the defaults of its fields, while a missing pointer to a struct
+	// is only allocated when it has some.
+	if v == nil {
+		if !isStruct(out.Type()) {
+			return nil
+		}
+		if out.Kind() == reflect.Ptr && out.IsNil() {
+			value := reflect.New(out.Type().Elem())
+			defaults := d.defaults
+			if err := d.decode(path, map[string]interface{}{}, value); err != nil {
+				return err
+			}
+			if d.defaults > defaults {
+				out.Set(value)
+			}
+			return nil
+		}
+		v = map[string]interface{}{}
+	}
+
+	if out.Kind() == reflect.Ptr {
+		if out.IsNil() {
+			out.Set(reflect.New(out.Type().Elem()))
+		}
+		return d.decode(path, v, out.Elem())
+	}
+
+	if out.CanAddr() && out.Addr().Type().Implements(textUnmarshalerType) {
+		s, ok := decodeScalar(v)
+		if !ok {
+			d.fail(path, "expected a string, got %v(%T)", v, v)
+			return nil
+		}
+		if err := out.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			d.fail(path, "%v", err)
+		}
+		return nil
+	}
+
+	if out.Type() == durationType {
+		switch t := v.(type) {
+		case string:
+			dur, err := time.ParseDuration(t)
+			if err != nil {
+				d.fail(path, "expected a duration like 5s, got %q", t)
+				return nil
+			}
+			out.SetInt(int64(dur))
+		default:
+			d.fail(path, "expected a duration like 5s, got %v(%T)", v, v)
+		}
+		return nil
+	}
+
+	switch out.Kind() {
+	case reflect.Interface:
+		if !reflect.TypeOf(v).AssignableTo(out.Type()) {
+			d.fail(path, "unsupported type %s for a value of type %T", out.Type(), v)
+			return nil
+		}
+		out.Set(reflect.ValueOf(v))
+	case reflect.String:
+		s, ok := decodeScalar(v)
+		if !ok {
+			d.fail(path, "expected a string, got %v(%T)", v, v)
+			return nil
+		}
+		out.SetString(s)
+	case reflect.Bool:
+		switch t := v.(type) {
+		case bool:
+			out.SetBool(t)
+		case string:
+			b, err := strconv.ParseBool(t)
+			if err != nil {
+				d.fail(path, "expected a boolean, got %q", t)
+				return nil
+			}
+			out.SetBool(b)
+		default:
+			d.fail(path, "expected a boolean, got %v(%T)", v, v)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s, ok := decodeScalar(v)
+		if !ok {
+			d.fail(path, "expected an integer, got %v(%T)", v, v)
+			return nil
+		}
+		i, err := strconv.ParseInt(s, 10, out.Type().Bits())
+		if err != nil {
+			d.fail(path, "expected an integer of %d bits, got %q", out.Type().Bits(), s)
+			return nil
+		}
+		out.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s, ok := decodeScalar(v)
+		if !ok {
+			d.fail(path, "expected an unsigned integer, got %v(%T)", v, v)
+			return nil
+		}
+		u, err := strconv.ParseUint(s, 10, out.Type().Bits())
+		if err != nil {
+			d.fail(path, "expected an unsigned integer of %d bits, got %q", out.Type().Bits(), s)
+			return nil
+		}
+		out.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		s, ok := decodeScalar(v)
+		if !ok {
+			d.fail(path, "expected a number, got %v(%T)", v, v)
+			return nil
+		}
+		f, err := strconv.ParseFloat(s, out.Type().Bits())
+		if err != nil {
+			d.fail(path, "expected a number, got %q", s)
+			return nil
+		}
+		out.SetFloat(f)
+	case reflect.Slice:
+		if s, ok := v.(string); ok && out.Type().Elem().Kind() == reflect.Uint8 {
+			out.SetBytes([]byte(s))
+			return nil
+		}
+		items, ok := listItems(v)
+		if !ok {
+			d.fail(path, "expected a list, got %v(%T)", v, v)
+			return nil
+		}
+		res := reflect.MakeSlice(out.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := d.decode(fmt.Sprintf("%s[%d]", path, i), item, res.Index(i)); err != nil {
+				return err
+			}
+		}
+		out.Set(res)
+	case reflect.Map:
+		m, ok := asStringKeyedMap(v)
+		if !ok {
+			d.fail(path, "expected a map, got %v(%T)", v, v)
+			return nil
+		}
+		if out.Type().Key().Kind() != reflect.String {
+			d.fail(path, "unsupported type %s: map keys must be strings", out.Type())
+			return nil
+		}
+		if out.IsNil() {
+			out.Set(reflect.MakeMap(out.Type()))
+		}
+		for k, item := range m {
+			value := reflect.New(out.Type().Elem()).Elem()
+			if err := d.decode(joinPath(path, k), item, value); err != nil {
+				return err
+			}
+			out.SetMapIndex(reflect.ValueOf(k).Convert(out.Type().Key()), value)
+		}
+	case reflect.Struct:
+		m, ok := asStringKeyedMap(v)
+		if !ok {
+			d.fail(path, "expected a map, got %v(%T)", v, v)
+			return nil
+		}
+		return d.decodeStruct(path, m, out)
+	default:
+		d.fail(path, "unsupported type %s", out.Type())
+	}
+	return nil
+}
+
+func (d *decoder) decodeStruct(path string, m map[string]interface{}, out reflect.Value) error {
+	t := out.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, inline := fieldName(f)
+		if name == "-" {
+			continue
+		}
+
+		if inline {
+			field := out.Field(i)
+			if field.Kind() == reflect.Ptr {
+				if field.IsNil() {
+					field.Set(reflect.New(f.Type.Elem()))
+				}
+				field = field.Elem()
+			}
+			if field.Kind() == reflect.Struct {
+				if err := d.decodeStruct(path, m, field); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		fieldPath := joinPath(path, name)
+
+		v, ok := m[name]
+		if def, hasDefault := f.Tag.Lookup(DecodeTag); !ok && hasDefault {
+			var err error
+			v, err = d.expand.InValue(def)
+			if err != nil {
+				d.fail(fieldPath, "%v", err)
+				continue
+			}
+			d.defaults++
+		}
+
+		if err := d.decode(fieldPath, v, out.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isStruct reports whether t is a struct or a pointer to one, decoded from a map rather than from text.
+func isStruct(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+func (d *decoder) fail(path, format string, args ...interface{}) {
+	if path == "" {
+		path = "."
+	}
+	d.errs = append(d.errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+// fieldName returns the key of the field in the input, and whether the field is inlined,
+// following the yaml tag, then the json tag, like yaml.v3.
+func fieldName(f reflect.StructField) (string, bool) {
+	for _, key := range []string{"yaml", "json"} {
+		tag, ok := f.Tag.Lookup(key)
+		if !ok {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		inline := strings.Contains(","+opts+",", ",inline,")
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		return name, inline || f.Anonymous && tag == ""
+	}
+	return strings.ToLower(f.Name), f.Anonymous
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// decodeScalar returns the string form of a string, a number or a boolean.
+func decodeScalar(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case float64:
+		if t == math.Trunc(t) && math.Abs(t) < 1<<53 {
+			return strconv.FormatInt(int64(t), 10), true
+		}
+		return strconv.FormatFloat(t, 'f', -1, 64), true
+	case bool, int, int64, uint64:
+		return fmt.Sprint(t), true
+	default:
+		return "", false
+	}
+}
+
+// listItems returns the items of a list, or of a string holding a YAML or JSON list or comma-separated values.
+func listItems(v interface{}) ([]interface{}, bool) {
+	switch t := v.(type) {
+	case []interface{}:
+		return t, true
+	case string:
+		if strings.HasPrefix(strings.TrimSpace(t), "[") {
+			var items []interface{}
+			if err := yaml.Unmarshal([]byte(t), &items); err == nil {
+				return items, true
+			}
+		}
+		if strings.TrimSpace(t) == "" {
+			return nil, true
+		}
+		parts := strings.Split(t, ",")
+		items := make([]interface{}, len(parts))
+		for i, p := range parts {
+			items[i] = strings.TrimSpace(p)
+		}
+		return items, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,193 @@
+package vals
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	type DB struct {
+		Host     string        `yaml:"host"`
+		Port     int           `yaml:"port"`
+		Password string        `yaml:"password" vals:"ref+echo://s3cr3t"`
+		Timeout  time.Duration `yaml:"timeout" vals:"ref+echo://5s"`
+	}
+
+	type Base struct {
+		Name string `yaml:"name"`
+	}
+
+	type Config struct {
+		Base     `yaml:",inline"`
+		DB       DB                `yaml:"db"`
+		Replica  *DB               `yaml:"replica"`
+		Hosts    []string          `yaml:"hosts"`
+		Ports    []int             `json:"ports"`
+		Debug    bool              `yaml:"debug" vals:"ref+echo://true"`
+		Ratio    float64           `yaml:"ratio"`
+		IP       net.IP            `yaml:"ip"`
+		Labels   map[string]string `yaml:"labels"`
+		Extra    interface{}       `yaml:"extra"`
+		Retries  uint8
+		Ignored  string `yaml:"-" vals:"ref+echo://ignored"`
+		internal string
+	}
+
+	input := `
+name: ref+echo://app
+db:
+  host: ref+echo://db.example.com
+  port: ref+echo://5432
+replica:
+  host: ref+self://#/db/host
+  port: 5433
+  timeout: 1m
+hosts: ref+echo://a.example.com,b.example.com
+ports: [80, "ref+echo://443"]
+ratio: ref+echo://0.5
+ip: ref+echo://10.0.0.1
+labels:
+  team: ref+echo://platform
+extra:
+  k: ref+echo://vv
+retries: ref+echo://13
+`
+
+	var cfg Config
+	err := Decode(context.Background(), strings.NewReader(input), &cfg, Options{})
+	require.NoError(t, err)
+
+	require.Equal(t, Config{
+		Base: Base{Name: "app"},
+		DB: DB{
+			Host:     "db.example.com",
+			Port:     5432,
+			Password: "s3cr3t",
+			Timeout:  5 * time.Second,
+		},
+		Replica: &DB{
+			Host:     "db.example.com",
+			Port:     5433,
+			Password: "s3cr3t",
+			Timeout:  time.Minute,
+		},
+		Hosts:   []string{"a.example.com", "b.example.com"},
+		Ports:   []int{80, 443},
+		Debug:   true,
+		Ratio:   0.5,
+		IP:      net.ParseIP("10.0.0.1"),
+		Labels:  map[string]string{"team": "platform"},
+		Extra:   map[string]interface{}{"k": "vv"},
+		Retries: 13,
+	}, cfg)
+}
+
+func TestDecode_DefaultsOnly(t *testing.T) {
+	type Config struct {
+		Token   string        `yaml:"token" vals:"ref+echo://tok"`
+		Hosts   []string      `yaml:"hosts" vals:"[a, b]"`
+		Timeout time.Duration `yaml:"timeout" vals:"10s"`
+	}
+
+	var cfg Config
+	err := Decode(context.Background(), nil, &cfg, Options{})
+	require.NoError(t, err)
+	require.Equal(t, Config{
+		Token:   "tok",
+		Hosts:   []string{"a", "b"},
+		Timeout: 10 * time.Second,
+	}, cfg)
+}
+
+func TestDecode_NestedDefaults(t *testing.T) {
+	type DB struct {
+		Host     string `yaml:"host"`
+		Password string `yaml:"password" vals:"ref+echo://s3cr3t"`
+	}
+
+	type TLS struct {
+		Cert string `yaml:"cert"`
+	}
+
+	type Config struct {
+		DB      DB   `yaml:"db"`
+		Replica *DB  `yaml:"replica"`
+		TLS     *TLS `yaml:"tls"`
+	}
+
+	for _, input := range []string{"", "db:\nreplica: null\n"} {
+		var cfg Config
+		err := Decode(context.Background(), strings.NewReader(input), &cfg, Options{})
+		require.NoError(t, err)
+		require.Equal(t, Config{
+			DB:      DB{Password: "s3cr3t"},
+			Replica: &DB{Password: "s3cr3t"},
+		}, cfg)
+	}
+
+	var cfg Config
+	err := Decode(context.Background(), nil, &cfg, Options{})
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", cfg.DB.Password)
+}
+
+func TestDecode_Errors(t *testing.T) {
+	type DB struct {
+		Port    int           `yaml:"port"`
+		Timeout time.Duration `yaml:"timeout"`
+	}
+
+	type Config struct {
+		DB    DB    `yaml:"db"`
+		Ports []int `yaml:"ports"`
+	}
+
+	input := `
+db:
+  port: ref+echo://abc
+  timeout: ref+echo://soon
+ports: [1, ref+echo://two]
+`
+
+	var cfg Config
+	err := Decode(context.Background(), strings.NewReader(input), &cfg, Options{})
+	require.Error(t, err)
+	require.Equal(t, `db.port: expected an integer of 64 bits, got "abc"
+db.timeout: expected a duration like 5s, got "soon"
+ports[1]: expected an integer of 64 bits, got "two"`, err.Error())
+
+	var duration struct {
+		Timeout time.Duration `yaml:"timeout"`
+	}
+	err = Decode(context.Background(), strings.NewReader("timeout: 30\n"), &duration, Options{})
+	require.EqualError(t, err, "timeout: expected a duration like 5s, got 30(int)")
+
+	var stringer struct {
+		S fmt.Stringer `yaml:"s"`
+	}
+	err = Decode(context.Background(), strings.NewReader("s: foo\n"), &stringer, Options{})
+	require.EqualError(t, err, "s: unsupported type fmt.Stringer for a value of type string")
+
+	err = Decode(context.Background(), strings.NewReader("db: {}\n---\ndb: {}\n"), &cfg, Options{})
+	require.EqualError(t, err, "decode: expected a single document, but got more")
+
+	err = Decode(context.Background(), strings.NewReader("db: {}\n---\n"), &cfg, Options{})
+	require.NoError(t, err)
+
+	err = Decode(context.Background(), strings.NewReader("- a\n"), &cfg, Options{})
+	require.EqualError(t, err, "decode: expected a map, got []interface {}")
+
+	err = Decode(context.Background(), nil, cfg, Options{})
+	require.EqualError(t, err, "decode: expected a non-nil pointer, got vals.Config")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Decode(ctx, strings.NewReader("db: {}\n"), &cfg, Options{})
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,398 @@
+package vals
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	EnvFormatPOSIX         = "posix"
+	EnvFormatFish          = "fish"
+	EnvFormatPowerShell    = "powershell"
+	EnvFormatCmd           = "cmd"
+	EnvFormatDotenv        = "dotenv"
+	EnvFormatJSON          = "json"
+	EnvFormatSystemd       = "systemd"
+	EnvFormatGitHubActions = "github-actions"
+	EnvFormatGitLabDotenv  = "gitlab-dotenv"
+)
+
+// EnvFormats are the formats supported by WriteEnv.
+var EnvFormats = []string{
+	EnvFormatPOSIX,
+	EnvFormatFish,
+	EnvFormatPowerShell,
+	EnvFormatCmd,
+	EnvFormatDotenv,
+	EnvFormatJSON,
+	EnvFormatSystemd,
+	EnvFormatGitHubActions,
+	EnvFormatGitLabDotenv,
+}
+
+// envNameRegexp matches the names of environment variables that all shells accept.
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// EnvVar is an environment variable rendered by WriteEnv.
+type EnvVar struct {
+	Name  string
+	Value string
+	// Secret is set when the value was fetched by a secretref+ expression, or flattened from a map or a list fetched by one.
+	Secret bool
+}
+
+const (
+	EnvCaseUpper = "upper"
+	EnvCaseLower = "lower"
+)
+
+// EnvConfig customizes how nested maps and lists are turned into environment variables.
+type EnvConfig struct {
+	// Separator joins the keys of nested maps and the indices of lists, like DB_HOST or ITEMS_0.
+	// Defaults to "_".
+	Separator string
+	// Case is either EnvCaseUpper or EnvCaseLower to change the case of the names. They are left as is by default.
+	Case string
+	// JSONValues passes the maps and lists at the top level as JSON, instead of flattening them.
+	JSONValues bool
+}
+
+// EnvVars evaluates the template like Env, and returns the variables sorted by name.
+func EnvVars(template map[string]interface{}, o ...Options) ([]EnvVar, error) {
+	var opts Options
+	if len(o) > 0 {
+		opts = o[0]
+	}
+
+	runtime, err := New(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = runtime.Close() }()
+	return runtime.envVars(template)
+}
+
+// envVars is EnvVars with the runtime, so that Exec shares it between the variables and the files.
+func (r *Runtime) envVars(template map[string]interface{}) ([]EnvVar, error) {
+	// Secrets are told apart by the refs that the values are fetched with.
+	secrets, _ := secretRefs(template).(map[string]interface{})
+
+	m, err := r.Eval(template)
+	if err != nil {
+		return nil, err
+	}
+
+	return flattenEnv(m, r.Options.Env, secrets)
+}
+
+// secretRefs returns the parts of v holding secretref+ expressions, as true in maps and lists shaped like v,
+// or nil when there are none.
+func secretRefs(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if strings.Contains(v, "secretref+") {
+			return true
+		}
+	case map[string]interface{}:
+		var res map[string]interface{}
+		for k, item := range v {
+			if s := secretRefs(item); s != nil {
+				if res == nil {
+					res = map[string]interface{}{}
+				}
+				res[k] = s
+			}
+		}
+		if res != nil {
+			return res
+		}
+	case []interface{}:
+		var found bool
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			res[i] = secretRefs(item)
+			found = found || res[i] != nil
+		}
+		if found {
+			return res
+		}
+	}
+	return nil
+}
+
+// secretRefsAt returns the part of the secretRefs result for the key or index of a map or a list.
+// A secretref+ can fetch a map or a list, so that everything under a secret is a secret too.
+func secretRefsAt(secrets interface{}, key string) interface{} {
+	switch s := secrets.(type) {
+	case bool:
+		return s
+	case map[string]interface{}:
+		return s[key]
+	case []interface{}:
+		if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(s) {
+			return s[i]
+		}
+	}
+	return nil
+}
+
+// flattenEnv turns m into variables sorted by name, flattening nested maps and lists,
+// and rendering numbers, booleans and nulls as strings.
+// The variables flattened from the parts of m marked in secrets, as returned by secretRefs, are secrets.
+func flattenEnv(m map[string]interface{}, c EnvConfig, secrets map[string]interface{}) ([]EnvVar, error) {
+	sep := c.Separator
+	if sep == "" {
+		sep = "_"
+	}
+
+	var vars []EnvVar
+	var flatten func(name string, v, secret interface{}) error
+	flatten = func(name string, v, secret interface{}) error {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, item := range v {
+				if err := flatten(name+sep+k, item, secretRefsAt(secret, k)); err != nil {
+					return err
+				}
+			}
+		case []interface{}:
+			for i, item := range v {
+				key := strconv.Itoa(i)
+				if err := flatten(name+sep+key, item, secretRefsAt(secret, key)); err != nil {
+					return err
+				}
+			}
+		default:
+			s, err := envValue(v)
+			if err != nil {
+				return err
+			}
+			vars = append(vars, EnvVar{Name: name, Value: s, Secret: secret != nil})
+		}
+		return nil
+	}
+
+	for k, v := range m {
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			if c.JSONValues {
+				bs, err := json.Marshal(v)
+				if err != nil {
+					return nil, fmt.Errorf("encoding the value of %s as JSON: %w", k, err)
+				}
+				vars = append(vars, EnvVar{Name: k, Value: string(bs), Secret: secrets[k] != nil})
+				continue
+			}
+			if err := flatten(k, v, secrets[k]); err != nil {
+				return nil, err
+			}
+		default:
+			if err := flatten(k, v, secrets[k]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i := range vars {
+		switch c.Case {
+		case EnvCaseUpper:
+			vars[i].Name = strings.ToUpper(vars[i].Name)
+		case EnvCaseLower:
+			vars[i].Name = strings.ToLower(vars[i].Name)
+		case "":
+		default:
+			return nil, fmt.Errorf("unsupported case %q: must be either %q or %q", c.Case, EnvCaseUpper, EnvCaseLower)
+		}
+	}
+
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Name < vars[j].Name
+	})
+	for i := 1; i < len(vars); i++ {
+		if vars[i].Name == vars[i-1].Name {
+			return nil, fmt.Errorf("duplicate environment variable %s: rename the keys that it is flattened from, or change the separator", vars[i].Name)
+		}
+	}
+
+	return vars, nil
+}
+
+func envValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("unexpected type of value: %v(%T)", v, v)
+	}
+}
+
+// EnvOutputConfig customizes how WriteEnv writes variables.
+type EnvOutputConfig struct {
+	// Export prepends "export" to each line of the posix format.
+	Export bool
+	// GitHubEnv receives the variables in the github-actions format, and is usually the file at $GITHUB_ENV.
+	// Only the ::add-mask:: commands for secret values are written to the writer passed to WriteEnv.
+	GitHubEnv io.Writer
+}
+
+// WriteEnv writes the variables in the given format, which is one of EnvFormats.
+func WriteEnv(w io.Writer, format string, vars []EnvVar, config ...EnvOutputConfig) error {
+	var c EnvOutputConfig
+	if len(config) > 0 {
+		c = config[0]
+	}
+
+	if format == EnvFormatJSON {
+		m := make(map[string]string, len(vars))
+		for _, v := range vars {
+			m[v.Name] = v.Value
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	}
+
+	for _, v := range vars {
+		valid := envNameRegexp
+		if format == EnvFormatDotenv {
+			valid = dotenvKeyRegexp
+		}
+		if !valid.MatchString(v.Name) {
+			return fmt.Errorf("%s output: %q is not a valid environment variable name", format, v.Name)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+
+	switch format {
+	case EnvFormatPOSIX:
+		for _, v := range vars {
+			if c.Export {
+				_, _ = bw.WriteString("export ")
+			}
+			_, _ = fmt.Fprintf(bw, "%s=%s\n", v.Name, quotePOSIX(v.Value))
+		}
+	case EnvFormatFish:
+		for _, v := range vars {
+			_, _ = fmt.Fprintf(bw, "set -gx %s '%s'\n", v.Name, fishEscaper.Replace(v.Value))
+		}
+	case EnvFormatPowerShell:
+		for _, v := range vars {
+			_, _ = fmt.Fprintf(bw, "$env:%s = '%s'\n", v.Name, powerShellEscaper.Replace(v.Value))
+		}
+	case EnvFormatCmd:
+		for _, v := range vars {
+			if strings.ContainsAny(v.Value, "\r\n") {
+				return fmt.Errorf("%s output: the value of %s spans multiple lines, which cmd does not support", format, v.Name)
+			}
+			_, _ = fmt.Fprintf(bw, "set \"%s=%s\"\n", v.Name, strings.ReplaceAll(v.Value, "%", "%%"))
+		}
+	case EnvFormatDotenv:
+		for _, v := range vars {
+			_, _ = fmt.Fprintf(bw, "%s=%s\n", v.Name, quoteDotenv(v.Value))
+		}
+	case EnvFormatSystemd:
+		for _, v := range vars {
+			_, _ = fmt.Fprintf(bw, "%s=\"%s\"\n", v.Name, systemdEscaper.Replace(v.Value))
+		}
+	case EnvFormatGitLabDotenv:
+		for _, v := range vars {
+			if strings.ContainsAny(v.Value, "\r\n") {
+				return fmt.Errorf("%s output: the value of %s spans multiple lines, which GitLab does not support", format, v.Name)
+			}
+			_, _ = fmt.Fprintf(bw, "%s=%s\n", v.Name, v.Value)
+		}
+	case EnvFormatGitHubActions:
+		if c.GitHubEnv == nil {
+			return errors.New("github-actions output: GITHUB_ENV is not set")
+		}
+		// Values are masked before they are exported, so that they never show up in logs.
+		for _, v := range vars {
+			if !v.Secret {
+				continue
+			}
+			for _, line := range strings.Split(strings.ReplaceAll(v.Value, "\r\n", "\n"), "\n") {
+				if line != "" {
+					_, _ = fmt.Fprintf(bw, "::add-mask::%s\n", githubCommandEscaper.Replace(line))
+				}
+			}
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		return writeGitHubEnv(c.GitHubEnv, vars)
+	default:
+		return fmt.Errorf("unsupported env format %q: must be one of %s", format, strings.Join(EnvFormats, ", "))
+	}
+
+	return bw.Flush()
+}
+
+// writeGitHubEnv writes the variables with the heredoc syntax of $GITHUB_ENV, which supports multi-line values,
+// delimited by a random string so that values cannot inject other variables.
+func writeGitHubEnv(w io.Writer, vars []EnvVar) error {
+	bw := bufio.NewWriter(w)
+	for _, v := range vars {
+		delimiter, err := githubDelimiter(v.Value)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(bw, "%s<<%s\n%s\n%s\n", v.Name, delimiter, v.Value, delimiter)
+	}
+	return bw.Flush()
+}
+
+func githubDelimiter(value string) (string, error) {
+	for {
+		bs := make([]byte, 16)
+		if _, err := rand.Read(bs); err != nil {
+			return "", err
+		}
+		d := "ghadelimiter_" + hex.EncodeToString(bs)
+		if !strings.Contains(value, d) {
+			return d, nil
+		}
+	}
+}
+
+// quotePOSIX quotes s for POSIX shells like Env does, leaving it as is when it only has safe characters.
+// Single-quoted strings can span multiple lines.
+func quotePOSIX(s string) string {
+	if !unsafeCharRegexp.MatchString(s) {
+		return s
+	}
+	return `'` + strings.ReplaceAll(s, `'`, `'"'"'`) + `'`
+}
+
+var (
+	// fishEscaper escapes the only characters with a meaning within single quotes in fish.
+	fishEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	// powerShellEscaper doubles single quotes, including the typographic ones that PowerShell treats alike.
+	powerShellEscaper = strings.NewReplacer(`'`, `''`, "‘", "‘‘", "’", "’’", "‚", "‚‚", "‛", "‛‛")
+	// githubCommandEscaper escapes the data of workflow commands, which the runner URL-decodes,
+	// so that a value like "a%25b" is masked as it is rather than as "a%b".
+	githubCommandEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	// systemdEscaper escapes the characters with a meaning within double quotes in EnvironmentFile=.
+	systemdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+)
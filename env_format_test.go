@@ -0,0 +1,224 @@
+package vals
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteEnv(t *testing.T) {
+	vars, err := EnvVars(map[string]interface{}{
+		"PLAIN":  "ref+echo://value",
+		"QUOTED": "it's $HOME",
+		"MULTI":  "line1\nline2",
+		"TOKEN":  "secretref+echo://s3cr3t",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []EnvVar{
+		{Name: "MULTI", Value: "line1\nline2"},
+		{Name: "PLAIN", Value: "value"},
+		{Name: "QUOTED", Value: "it's $HOME"},
+		{Name: "TOKEN", Value: "s3cr3t", Secret: true},
+	}, vars)
+
+	testCases := []struct {
+		format   string
+		config   EnvOutputConfig
+		expected string
+		err      string
+	}{
+		{
+			format:   EnvFormatPOSIX,
+			config:   EnvOutputConfig{Export: true},
+			expected: "export MULTI='line1\nline2'\nexport PLAIN=value\nexport QUOTED='it'\"'\"'s $HOME'\nexport TOKEN=s3cr3t\n",
+		},
+		{
+			format:   EnvFormatFish,
+			expected: "set -gx MULTI 'line1\nline2'\nset -gx PLAIN 'value'\nset -gx QUOTED 'it\\'s $HOME'\nset -gx TOKEN 's3cr3t'\n",
+		},
+		{
+			format:   EnvFormatPowerShell,
+			expected: "$env:MULTI = 'line1\nline2'\n$env:PLAIN = 'value'\n$env:QUOTED = 'it''s $HOME'\n$env:TOKEN = 's3cr3t'\n",
+		},
+		{
+			format: EnvFormatCmd,
+			err:    "cmd output: the value of MULTI spans multiple lines, which cmd does not support",
+		},
+		{
+			format:   EnvFormatDotenv,
+			expected: "MULTI=\"line1\\nline2\"\nPLAIN=value\nQUOTED=\"it's \\$HOME\"\nTOKEN=s3cr3t\n",
+		},
+		{
+			format:   EnvFormatJSON,
+			expected: "{\n  \"MULTI\": \"line1\\nline2\",\n  \"PLAIN\": \"value\",\n  \"QUOTED\": \"it's $HOME\",\n  \"TOKEN\": \"s3cr3t\"\n}\n",
+		},
+		{
+			format:   EnvFormatSystemd,
+			expected: "MULTI=\"line1\nline2\"\nPLAIN=\"value\"\nQUOTED=\"it's \\$HOME\"\nTOKEN=\"s3cr3t\"\n",
+		},
+		{
+			format: EnvFormatGitLabDotenv,
+			err:    "gitlab-dotenv output: the value of MULTI spans multiple lines, which GitLab does not support",
+		},
+		{
+			format: EnvFormatGitHubActions,
+			err:    "github-actions output: GITHUB_ENV is not set",
+		},
+		{
+			format: "csh",
+			err:    `unsupported env format "csh": must be one of posix, fish, powershell, cmd, dotenv, json, systemd, github-actions, gitlab-dotenv`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			err := WriteEnv(out, tc.format, vars, tc.config)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, out.String())
+		})
+	}
+
+	t.Run("cmd", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		err := WriteEnv(out, EnvFormatCmd, []EnvVar{{Name: "A", Value: `50% & "more"`}})
+		require.NoError(t, err)
+		require.Equal(t, "set \"A=50%% & \"more\"\"\n", out.String())
+	})
+
+	t.Run("github-actions", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		githubEnv := &bytes.Buffer{}
+		err := WriteEnv(out, EnvFormatGitHubActions, append(vars, EnvVar{Name: "KEY", Value: "a\nb", Secret: true}), EnvOutputConfig{GitHubEnv: githubEnv})
+		require.NoError(t, err)
+		require.Equal(t, "::add-mask::s3cr3t\n::add-mask::a\n::add-mask::b\n", out.String())
+
+		d := `ghadelimiter_[0-9a-f]{32}`
+		require.Regexp(t, regexp.MustCompile(`^MULTI<<(`+d+`)\nline1\nline2\n`+d+`\nPLAIN<<`+d+`\nvalue\n`+d+`\nQUOTED<<`+d+`\nit's \$HOME\n`+d+`\nTOKEN<<`+d+`\ns3cr3t\n`+d+`\nKEY<<`+d+`\na\nb\n`+d+`\n$`), githubEnv.String())
+	})
+
+	t.Run("github-actions escaping", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		err := WriteEnv(out, EnvFormatGitHubActions, []EnvVar{{Name: "TOKEN", Value: "a%0Ab%25c\rd", Secret: true}}, EnvOutputConfig{GitHubEnv: &bytes.Buffer{}})
+		require.NoError(t, err)
+		require.Equal(t, "::add-mask::a%250Ab%2525c%0Dd\n", out.String())
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		err := WriteEnv(&bytes.Buffer{}, EnvFormatPOSIX, []EnvVar{{Name: "A;rm -rf /", Value: "x"}})
+		require.EqualError(t, err, `posix output: "A;rm -rf /" is not a valid environment variable name`)
+	})
+}
+
+func TestEnvVars_Nested(t *testing.T) {
+	template := func() map[string]interface{} {
+		return map[string]interface{}{
+			"db": map[string]interface{}{
+				"host":     "ref+echo://db.example.com",
+				"port":     5432,
+				"password": "secretref+echo://s3cr3t",
+			},
+			"items": []interface{}{"ref+echo://aa", true, 1.5},
+			"debug": false,
+			"empty": nil,
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		config   EnvConfig
+		expected []EnvVar
+		err      string
+	}{
+		{
+			name: "defaults",
+			expected: []EnvVar{
+				{Name: "db_host", Value: "db.example.com"},
+				{Name: "db_password", Value: "s3cr3t", Secret: true},
+				{Name: "db_port", Value: "5432"},
+				{Name: "debug", Value: "false"},
+				{Name: "empty", Value: ""},
+				{Name: "items_0", Value: "aa"},
+				{Name: "items_1", Value: "true"},
+				{Name: "items_2", Value: "1.5"},
+			},
+		},
+		{
+			name:   "separator and case",
+			config: EnvConfig{Separator: "__", Case: EnvCaseUpper},
+			expected: []EnvVar{
+				{Name: "DB__HOST", Value: "db.example.com"},
+				{Name: "DB__PASSWORD", Value: "s3cr3t", Secret: true},
+				{Name: "DB__PORT", Value: "5432"},
+				{Name: "DEBUG", Value: "false"},
+				{Name: "EMPTY", Value: ""},
+				{Name: "ITEMS__0", Value: "aa"},
+				{Name: "ITEMS__1", Value: "true"},
+				{Name: "ITEMS__2", Value: "1.5"},
+			},
+		},
+		{
+			name:   "json values",
+			config: EnvConfig{JSONValues: true},
+			expected: []EnvVar{
+				{Name: "db", Value: `{"host":"db.example.com","password":"s3cr3t","port":5432}`, Secret: true},
+				{Name: "debug", Value: "false"},
+				{Name: "empty", Value: ""},
+				{Name: "items", Value: `["aa",true,1.5]`},
+			},
+		},
+		{
+			name:   "unsupported case",
+			config: EnvConfig{Case: "camel"},
+			err:    `unsupported case "camel": must be either "upper" or "lower"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			vars, err := EnvVars(template(), Options{Env: tc.config})
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, vars)
+		})
+	}
+
+	t.Run("map-valued secret", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "db.yaml")
+		require.NoError(t, os.WriteFile(file, []byte("db:\n  host: db.example.com\n  password: s3cr3t\n"), 0600))
+
+		vars, err := EnvVars(map[string]interface{}{
+			"db":    "secretref+file://" + file + "#/db",
+			"db_ro": "ref+echo://readonly",
+		})
+		require.NoError(t, err)
+		require.Equal(t, []EnvVar{
+			{Name: "db_host", Value: "db.example.com", Secret: true},
+			{Name: "db_password", Value: "s3cr3t", Secret: true},
+			{Name: "db_ro", Value: "readonly"},
+		}, vars)
+
+		var out, githubEnv bytes.Buffer
+		require.NoError(t, WriteEnv(&out, EnvFormatGitHubActions, vars, EnvOutputConfig{GitHubEnv: &githubEnv}))
+		require.Equal(t, "::add-mask::db.example.com\n::add-mask::s3cr3t\n", out.String())
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		_, err := EnvVars(map[string]interface{}{
+			"db_host": "a",
+			"db":      map[string]interface{}{"host": "b"},
+		})
+		require.EqualError(t, err, "duplicate environment variable db_host: rename the keys that it is flattened from, or change the separator")
+	})
+}
@@ -0,0 +1,330 @@
+package vals
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EscapeAuto  = "auto"
+	EscapeJSON  = "json"
+	EscapeYAML  = "yaml"
+	EscapeTOML  = "toml"
+	EscapeShell = "shell"
+	EscapeXML   = "xml"
+)
+
+// EscapeFormats lists the syntaxes that Flatten is able to escape values for.
+var EscapeFormats = []string{EscapeJSON, EscapeYAML, EscapeTOML, EscapeShell, EscapeXML}
+
+// DetectEscape guesses the syntax of the file from its name for Flatten.
+// It returns an empty string when the syntax is unknown, in which case values are spliced in verbatim.
+func DetectEscape(path string) string {
+	base := strings.ToLower(filepath.Base(path))
+
+	switch filepath.Ext(base) {
+	case ".json", ".json5", ".jsonc":
+		return EscapeJSON
+	case ".yaml", ".yml":
+		return EscapeYAML
+	case ".toml":
+		return EscapeTOML
+	case ".sh", ".bash", ".zsh", ".env", ".envrc":
+		return EscapeShell
+	case ".xml":
+		return EscapeXML
+	}
+
+	if strings.HasPrefix(base, ".env.") {
+		return EscapeShell
+	}
+
+	return ""
+}
+
+// escaper escapes a value for the syntax surrounding the ref expression it replaces.
+type escaper func(val interface{}, before, after string) (string, error)
+
+func newEscaper(escape string) (escaper, error) {
+	switch escape {
+	case EscapeJSON:
+		return escapeJSONValue, nil
+	case EscapeYAML:
+		return escapeYAMLValue, nil
+	case EscapeTOML:
+		return escapeTOMLValue, nil
+	case EscapeShell:
+		return escapeShellValue, nil
+	case EscapeXML:
+		return escapeXMLValue, nil
+	}
+	return nil, fmt.Errorf("unsupported escape %q: must be one of %s", escape, strings.Join(EscapeFormats, ", "))
+}
+
+// currentLine returns the text between the last newline in before and the first newline in after.
+func currentLine(before, after string) (string, string) {
+	if i := strings.LastIndexByte(before, '\n'); i >= 0 {
+		before = before[i+1:]
+	}
+	if i := strings.IndexByte(after, '\n'); i >= 0 {
+		after = after[:i]
+	}
+	return before, after
+}
+
+// enclosingQuote returns the quote character of the string literal that is still open
+// at the end of line, or 0 when the end of line is outside of any string literal.
+// When strict is set, a quote only opens a string at the start of a value, as it is in YAML.
+func enclosingQuote(line string, strict bool) byte {
+	var q byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case q == '"' && c == '\\':
+			i++
+		case q != 0:
+			if c == q {
+				q = 0
+			}
+		case c == '"' || c == '\'':
+			if !strict || startsValue(line[:i]) {
+				q = c
+			}
+		}
+	}
+	return q
+}
+
+func startsValue(before string) bool {
+	t := strings.TrimRight(before, " \t")
+	return t == "" || strings.ContainsAny(t[len(t)-1:], ":-[{,")
+}
+
+// isWholeValue reports whether the expression makes up the entire value on its line,
+// like `key: ref+...` or `- ref+...`, so that the value can be replaced by a quoted string.
+func isWholeValue(before, after string) bool {
+	after = strings.TrimRight(after, " \t\r")
+	return startsValue(before) && (after == "" || strings.HasPrefix(after, " #") || strings.HasPrefix(after, "\t#"))
+}
+
+func scalarString(val interface{}) (string, error) {
+	switch val.(type) {
+	case nil:
+		return "", nil
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+		return "", fmt.Errorf("value of type %T cannot be embedded in text", val)
+	}
+	return fmt.Sprintf("%v", val), nil
+}
+
+// jsonString returns s as a JSON string literal, without escaping HTML characters.
+func jsonString(s string) string {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func escapeJSONValue(val interface{}, before, after string) (string, error) {
+	line, _ := currentLine(before, after)
+
+	switch enclosingQuote(line, false) {
+	case '"':
+		s, err := scalarString(val)
+		if err != nil {
+			return "", err
+		}
+		q := jsonString(s)
+		return q[1 : len(q)-1], nil
+	case '\'':
+		// JSON5 single-quoted string
+		s, err := scalarString(val)
+		if err != nil {
+			return "", err
+		}
+		q := jsonString(s)
+		q = strings.ReplaceAll(q[1:len(q)-1], `\"`, `"`)
+		return strings.ReplaceAll(q, `'`, `\'`), nil
+	}
+
+	if s, ok := val.(string); ok {
+		if json.Valid([]byte(s)) && !strings.ContainsAny(s[:1], `{["`) {
+			// A number, a boolean or null
+			return s, nil
+		}
+		return jsonString(s), nil
+	}
+
+	bs, err := json.Marshal(val)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+func escapeYAMLValue(val interface{}, before, after string) (string, error) {
+	s, err := scalarString(val)
+	if err != nil {
+		return "", err
+	}
+
+	line, rest := currentLine(before, after)
+
+	switch enclosingQuote(line, true) {
+	case '"':
+		q := jsonString(s)
+		return q[1 : len(q)-1], nil
+	case '\'':
+		if strings.ContainsAny(s, "\r\n") {
+			return "", fmt.Errorf("multi-line value cannot be represented in a single-quoted YAML string")
+		}
+		return strings.ReplaceAll(s, `'`, `''`), nil
+	}
+
+	if isPlainYAML(s) {
+		return s, nil
+	}
+	if !isWholeValue(line, rest) {
+		return "", fmt.Errorf("value %s cannot be represented within a plain YAML scalar: quote the surrounding string", strconv.Quote(s))
+	}
+	return jsonString(s), nil
+}
+
+// isPlainYAML reports whether s reads back as the same scalar when written unquoted as a YAML value.
+func isPlainYAML(s string) bool {
+	if s == "" || strings.ContainsAny(s, "\r\n") {
+		return false
+	}
+	var m map[string]interface{}
+	if err := yaml.Unmarshal([]byte("k: "+s), &m); err != nil || len(m) != 1 {
+		return false
+	}
+	v, ok := m["k"]
+	if !ok || v == nil {
+		return false
+	}
+	return !isNonScalar(v) && fmt.Sprintf("%v", v) == s
+}
+
+func isNonScalar(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	}
+	return false
+}
+
+func escapeTOMLValue(val interface{}, before, after string) (string, error) {
+	s, err := scalarString(val)
+	if err != nil {
+		return "", err
+	}
+
+	line, _ := currentLine(before, after)
+
+	switch enclosingQuote(line, false) {
+	case '"':
+		return tomlEscape(s), nil
+	case '\'':
+		if strings.ContainsAny(s, "'\r\n") {
+			return "", fmt.Errorf("value %s cannot be represented in a TOML literal string", strconv.Quote(s))
+		}
+		return s, nil
+	}
+
+	if _, err := strconv.ParseFloat(s, 64); err == nil || s == "true" || s == "false" {
+		return s, nil
+	}
+	return `"` + tomlEscape(s) + `"`, nil
+}
+
+// tomlEscape escapes s for use within a TOML basic string.
+func tomlEscape(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&sb, `\u%04X`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	return sb.String()
+}
+
+var shellDoubleQuoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`")
+
+func escapeShellValue(val interface{}, before, after string) (string, error) {
+	s, err := scalarString(val)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsRune(s, 0) {
+		return "", fmt.Errorf("value containing a NUL byte cannot be represented in shell")
+	}
+
+	line, _ := currentLine(before, after)
+
+	switch enclosingQuote(line, false) {
+	case '\'':
+		return strings.ReplaceAll(s, `'`, `'"'"'`), nil
+	case '"':
+		return shellDoubleQuoteEscaper.Replace(s), nil
+	}
+
+	if unsafeCharRegexp.MatchString(s) {
+		return `'` + strings.ReplaceAll(s, `'`, `'"'"'`) + `'`, nil
+	}
+	return s, nil
+}
+
+func escapeXMLValue(val interface{}, _, _ string) (string, error) {
+	s, err := scalarString(val)
+	if err != nil {
+		return "", err
+	}
+
+	for _, r := range s {
+		if !isXMLChar(r) {
+			return "", fmt.Errorf("value contains the character %U which is not allowed in XML", r)
+		}
+	}
+
+	var sb strings.Builder
+	if err := xml.EscapeText(&sb, []byte(s)); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// isXMLChar reports whether r is in the Char production of the XML 1.0 spec.
+func isXMLChar(r rune) bool {
+	return r == 0x09 || r == 0x0A || r == 0x0D ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
@@ -0,0 +1,176 @@
+package vals
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"syscall"
+)
+
+// FilesKey is the key of the section of the template of Exec whose values are written to files,
+// instead of being set as environment variables.
+const FilesKey = "files"
+
+// splitFiles returns the template without its files section, if any, and the files section.
+// A files key whose value is not a map is left as is, and ends up as an environment variable.
+func splitFiles(template map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	files, ok := template[FilesKey].(map[string]interface{})
+	if !ok {
+		return template, nil
+	}
+
+	rest := make(map[string]interface{}, len(template)-1)
+	for k, v := range template {
+		if k != FilesKey {
+			rest[k] = v
+		}
+	}
+	return rest, files
+}
+
+// secretFiles are files holding the values of refs for a command, in a private directory.
+type secretFiles struct {
+	dir  string
+	keys []string
+}
+
+// secretFilesBaseDir returns a directory backed by memory when possible, so that secrets are never written to disk.
+func secretFilesBaseDir() string {
+	if runtime.GOOS != "linux" {
+		return os.TempDir()
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		return "/dev/shm"
+	}
+	return os.TempDir()
+}
+
+// resolveFiles resolves the refs in the values of files, whose keys name both the files and the environment variables pointing at them.
+func resolveFiles(files map[string]interface{}, runtime *Runtime) (map[string]string, error) {
+	for k := range files {
+		if !envNameRegexp.MatchString(k) {
+			return nil, fmt.Errorf("invalid file name %q: must be usable as an environment variable name", k)
+		}
+	}
+
+	values, err := runtime.Eval(files)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]string, len(values))
+	for k, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type of value for file %s: %v(%T)", k, v, v)
+		}
+		res[k] = s
+	}
+	return res, nil
+}
+
+// newSecretFiles creates the directory of the files, readable only by the current user.
+func newSecretFiles() (*secretFiles, error) {
+	dir, err := os.MkdirTemp(secretFilesBaseDir(), "vals-exec-")
+	if err != nil {
+		return nil, err
+	}
+	return &secretFiles{dir: dir}, nil
+}
+
+// write writes each value to the file named after its key, readable only by the current user.
+// Existing files are replaced atomically, so that a command never reads a partially written file.
+func (f *secretFiles) write(values map[string]string) error {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		tmp, err := os.CreateTemp(f.dir, "."+k+"-")
+		if err != nil {
+			return err
+		}
+		_, err = tmp.WriteString(values[k])
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), filepath.Join(f.dir, k))
+		}
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+			return err
+		}
+	}
+
+	f.keys = keys
+	return nil
+}
+
+// env returns the environment variables pointing at the files. It is nil-safe.
+func (f *secretFiles) env() []string {
+	if f == nil {
+		return nil
+	}
+	env := make([]string, 0, len(f.keys))
+	for _, k := range f.keys {
+		env = append(env, fmt.Sprintf("%s=%s", k, filepath.Join(f.dir, k)))
+	}
+	return env
+}
+
+// remove overwrites the files with zeros before removing them along with their directory,
+// so that their contents don't outlive them on filesystems that reuse blocks.
+func (f *secretFiles) remove() error {
+	for _, k := range f.keys {
+		path := filepath.Join(f.dir, k)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if fp, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil {
+			_, _ = fp.Write(make([]byte, info.Size()))
+			_ = fp.Sync()
+			_ = fp.Close()
+		}
+	}
+	return os.RemoveAll(f.dir)
+}
+
+// runForwardingSignals runs cmd, forwarding the signals that would otherwise terminate vals to it,
+// so that vals outlives the command and cleans up after it.
+func runForwardingSignals(cmd *exec.Cmd) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				_ = cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return cmd.Wait()
+}
@@ -0,0 +1,169 @@
+package vals
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// execStopTimeout is how long a command is given to exit after SIGTERM, before it is killed, when it is restarted.
+const execStopTimeout = 10 * time.Second
+
+// execWatcher runs the command of Exec, and restarts or signals it when the values of its refs change.
+type execWatcher struct {
+	config  ExecConfig
+	newCmd  func(env []string) *exec.Cmd
+	resolve func() ([]string, map[string]string, error)
+	secrets *secretFiles
+	log     io.Writer
+
+	cmd    *exec.Cmd
+	exited chan error
+}
+
+// run starts the command with env and runs until it exits on its own, or because of a signal forwarded to it.
+func (w *execWatcher) run(env []string, files map[string]string) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+
+	if err := w.start(env); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(w.config.WatchInterval)
+	defer ticker.Stop()
+
+	envHash, filesHash := hashEnv(env), hashFiles(files)
+
+	for {
+		select {
+		case sig := <-sigs:
+			_ = w.cmd.Process.Signal(sig)
+		case err := <-w.exited:
+			return err
+		case <-ticker.C:
+			newEnv, newFiles, err := w.resolve()
+			if err != nil {
+				fmt.Fprintf(w.log, "vals: keeping the current values, as resolving the new ones failed: %v\n", err)
+				continue
+			}
+
+			newEnvHash, newFilesHash := hashEnv(newEnv), hashFiles(newFiles)
+			if newEnvHash == envHash && newFilesHash == filesHash {
+				continue
+			}
+
+			if newFilesHash != filesHash {
+				if err := w.secrets.write(newFiles); err != nil {
+					fmt.Fprintf(w.log, "vals: keeping the current values, as updating the files failed: %v\n", err)
+					continue
+				}
+			}
+			envChanged := newEnvHash != envHash
+			envHash, filesHash = newEnvHash, newFilesHash
+
+			if w.config.OnChange == ExecOnChangeSignal && !envChanged {
+				sig := w.config.ReloadSignal
+				if sig == nil {
+					sig = syscall.SIGHUP
+				}
+				fmt.Fprintf(w.log, "vals: values changed, sending %v to the command\n", sig)
+				if err := w.cmd.Process.Signal(sig); err != nil {
+					fmt.Fprintf(w.log, "vals: sending %v to the command: %v\n", sig, err)
+				}
+				continue
+			}
+
+			fmt.Fprintf(w.log, "vals: values changed, restarting the command\n")
+			w.stop()
+			if err := w.start(newEnv); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (w *execWatcher) start(env []string) error {
+	w.cmd = w.newCmd(env)
+	if err := w.cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan error, 1)
+	cmd := w.cmd
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	w.exited = exited
+
+	return nil
+}
+
+// stop sends SIGTERM to the command, and kills it when it doesn't exit within execStopTimeout.
+func (w *execWatcher) stop() {
+	if err := w.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		_ = w.cmd.Process.Kill()
+	}
+
+	select {
+	case <-w.exited:
+	case <-time.After(execStopTimeout):
+		_ = w.cmd.Process.Kill()
+		<-w.exited
+	}
+}
+
+func hashEnv(env []string) [sha256.Size]byte {
+	sorted := append([]string(nil), env...)
+	sort.Strings(sorted)
+
+	h := sha256.New()
+	for _, kv := range sorted {
+		_, _ = fmt.Fprintf(h, "%d:%s", len(kv), kv)
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+func hashFiles(files map[string]string) [sha256.Size]byte {
+	env := make([]string, 0, len(files))
+	for k, v := range files {
+		env = append(env, k+"="+v)
+	}
+	return hashEnv(env)
+}
+
+// copyMap returns a deep copy of the maps and lists in m.
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[k] = copyValue(v)
+	}
+	return res
+}
+
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return copyMap(v)
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			res[i] = copyValue(item)
+		}
+		return res
+	default:
+		return v
+	}
+}
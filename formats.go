@@ -0,0 +1,518 @@
+package vals
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatJSON   = "json"
+	FormatJSON5  = "json5"
+	FormatTOML   = "toml"
+	FormatHCL    = "hcl"
+	FormatDotenv = "dotenv"
+
+	FormatProperties = "properties"
+	// FormatTFVars is an alias of FormatHCL, as Terraform variable files are plain HCL attributes.
+	FormatTFVars = "tfvars"
+)
+
+// OutputFormats lists the formats accepted by Output.
+var OutputFormats = []string{FormatYAML, FormatJSON, FormatJSON5, FormatTOML, FormatHCL, FormatTFVars, FormatDotenv, FormatProperties}
+
+// InputFormats lists the formats accepted by InputsFormat.
+var InputFormats = []string{FormatYAML, FormatJSON, FormatJSON5, FormatTOML, FormatHCL, FormatDotenv}
+
+// DetectFormat guesses the format of the file from its name.
+// Files with unknown extensions, and stdin, are treated as YAML,
+// which is also able to read plain JSON.
+func DetectFormat(path string) string {
+	base := strings.ToLower(filepath.Base(path))
+
+	switch filepath.Ext(base) {
+	case ".json":
+		return FormatJSON
+	case ".json5", ".jsonc":
+		return FormatJSON5
+	case ".toml":
+		return FormatTOML
+	case ".hcl", ".tfvars":
+		return FormatHCL
+	case ".env":
+		return FormatDotenv
+	}
+
+	// e.g. .env.local, .env.production
+	if strings.HasPrefix(base, ".env.") {
+		return FormatDotenv
+	}
+
+	return FormatYAML
+}
+
+// nodesFromFormat decodes the content of the reader according to the format
+// into YAML document nodes, so that they can be passed to EvalNodes.
+func nodesFromFormat(reader io.Reader, format, filename string) ([]yaml.Node, error) {
+	switch format {
+	case "", FormatYAML, FormatJSON:
+		return nodesFromReader(reader)
+	}
+
+	bs, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var node *yaml.Node
+	switch format {
+	case FormatJSON5:
+		return nodesFromReader(bytes.NewReader(stripJSONComments(bs)))
+	case FormatTOML:
+		node, err = decodeTOML(bs)
+	case FormatHCL, FormatTFVars:
+		node, err = decodeHCL(bs, filename)
+	case FormatDotenv:
+		node, err = decodeDotenv(bs)
+	default:
+		return nil, fmt.Errorf("unsupported input format %q: must be one of %s", format, strings.Join(InputFormats, ", "))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", format, err)
+	}
+
+	return []yaml.Node{{Kind: yaml.DocumentNode, Content: []*yaml.Node{node}}}, nil
+}
+
+// mappingNode builds a YAML mapping node whose keys are in the given order.
+func mappingNode(keys []string, values map[string]interface{}) (*yaml.Node, error) {
+	m := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, k := range keys {
+		var v yaml.Node
+		if err := v.Encode(values[k]); err != nil {
+			return nil, err
+		}
+		m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}, &v)
+	}
+	return m, nil
+}
+
+// stripJSONComments blanks out // and /* */ comments outside of string literals,
+// leaving the line structure intact so that parse errors point at the right line.
+// The result, including JSON5's unquoted keys, single-quoted strings and trailing
+// commas, is then readable as YAML flow syntax.
+func stripJSONComments(bs []byte) []byte {
+	out := make([]byte, len(bs))
+	copy(out, bs)
+
+	var quote byte
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := bytes.Index(out[i+2:], []byte("*/"))
+			if end == -1 {
+				end = len(out)
+			} else {
+				end += i + 4
+			}
+			for ; i < end; i++ {
+				if out[i] != '\n' {
+					out[i] = ' '
+				}
+			}
+			i--
+		}
+	}
+
+	return out
+}
+
+func decodeTOML(bs []byte) (*yaml.Node, error) {
+	m := map[string]interface{}{}
+	md, err := toml.Decode(string(bs), &m)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, k := range md.Keys() {
+		if len(k) == 1 {
+			keys = append(keys, k[0])
+		}
+	}
+
+	return mappingNode(keys, m)
+}
+
+func decodeHCL(bs []byte, filename string) (*yaml.Node, error) {
+	file, diags := hclsyntax.ParseConfig(bs, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	attrs, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	sorted := make([]*hcl.Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		sorted = append(sorted, attr)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Range.Start.Byte < sorted[j].Range.Start.Byte
+	})
+
+	keys := make([]string, 0, len(sorted))
+	values := make(map[string]interface{}, len(sorted))
+	for _, attr := range sorted {
+		val, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		bs, err := ctyjson.SimpleJSONValue{Value: val}.MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", attr.Name, err)
+		}
+
+		// Decoding JSON as YAML keeps integers as ints instead of float64s
+		var v interface{}
+		if err := yaml.Unmarshal(bs, &v); err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", attr.Name, err)
+		}
+
+		keys = append(keys, attr.Name)
+		values[attr.Name] = v
+	}
+
+	return mappingNode(keys, values)
+}
+
+var dotenvKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// decodeDotenv reads KEY=value lines as understood by docker-compose and most dotenv libraries.
+// Values are taken literally: variable interpolation is left to the consumer.
+func decodeDotenv(bs []byte) (*yaml.Node, error) {
+	var (
+		keys   []string
+		values = map[string]interface{}{}
+	)
+
+	src := strings.ReplaceAll(string(bs), "\r\n", "\n")
+	lineNo := 0
+	for pos := 0; pos < len(src); {
+		lineNo++
+
+		eol := strings.IndexByte(src[pos:], '\n')
+		if eol == -1 {
+			eol = len(src)
+		} else {
+			eol += pos
+		}
+		line := src[pos:eol]
+		next := eol + 1
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			pos = next
+			continue
+		}
+		trimmed = strings.TrimPrefix(trimmed, "export ")
+
+		k, v, ok := strings.Cut(trimmed, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNo)
+		}
+		k = strings.TrimSpace(k)
+		if !dotenvKeyRegexp.MatchString(k) {
+			return nil, fmt.Errorf("line %d: invalid key %q", lineNo, k)
+		}
+		v = strings.TrimLeft(v, " \t")
+
+		var value string
+		if len(v) > 0 && (v[0] == '"' || v[0] == '\'') {
+			// Quoted values may span multiple lines, so look for the closing quote in the rest of the input
+			quote := v[0]
+			start := strings.IndexByte(src[pos:], quote) + pos + 1
+			end := closingQuote(src[start:], quote)
+			if end == -1 {
+				return nil, fmt.Errorf("line %d: unterminated quoted value for %s", lineNo, k)
+			}
+			value = src[start : start+end]
+			lineNo += strings.Count(value, "\n")
+			if quote == '"' {
+				value = unescapeDotenv(value)
+			}
+
+			next = len(src) + 1
+			if i := strings.IndexByte(src[start+end:], '\n'); i >= 0 {
+				next = start + end + i + 1
+			}
+		} else {
+			if i := strings.Index(v, " #"); i >= 0 {
+				v = v[:i]
+			}
+			value = strings.TrimSpace(v)
+		}
+
+		if _, ok := values[k]; !ok {
+			keys = append(keys, k)
+		}
+		values[k] = value
+		pos = next
+	}
+
+	return mappingNode(keys, values)
+}
+
+// closingQuote returns the index of the quote terminating s, skipping backslash escapes within double quotes.
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		if quote == '"' && s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+var dotenvUnescaper = strings.NewReplacer(`\n`, "\n", `\r`, "\r", `\t`, "\t", `\"`, `"`, `\\`, `\`, `\$`, `$`)
+
+func unescapeDotenv(s string) string {
+	return dotenvUnescaper.Replace(s)
+}
+
+var dotenvEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`, `$`, `\$`)
+
+var dotenvSafeValueRegexp = regexp.MustCompile(`^[\w@%+=:,./-]*$`)
+
+// quoteDotenv quotes the value so that it reads back verbatim with docker-compose and dotenv libraries.
+func quoteDotenv(s string) string {
+	if dotenvSafeValueRegexp.MatchString(s) {
+		return s
+	}
+	if !strings.ContainsAny(s, "'\n\r") {
+		return `'` + s + `'`
+	}
+	return `"` + dotenvEscaper.Replace(s) + `"`
+}
+
+// documentMapping returns the mapping node at the root of the YAML document,
+// for formats that can only represent a single top-level map.
+func documentMapping(node yaml.Node, format string) (*yaml.Node, error) {
+	n := &node
+	if n.Kind == yaml.DocumentNode {
+		if len(n.Content) == 0 {
+			return &yaml.Node{Kind: yaml.MappingNode}, nil
+		}
+		n = n.Content[0]
+	}
+	if n.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s output requires a map at the top level of the document", format)
+	}
+	return n, nil
+}
+
+func encodeTOML(w io.Writer, node yaml.Node) error {
+	var m map[string]interface{}
+	if err := node.Decode(&m); err != nil {
+		return fmt.Errorf("%s output requires a map at the top level of the document: %w", FormatTOML, err)
+	}
+	return toml.NewEncoder(w).Encode(m)
+}
+
+func encodeHCL(w io.Writer, node yaml.Node) error {
+	n, err := documentMapping(node, FormatHCL)
+	if err != nil {
+		return err
+	}
+
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+	for i := 0; i < len(n.Content); i += 2 {
+		k := n.Content[i].Value
+		if !hclsyntax.ValidIdentifier(k) {
+			return fmt.Errorf("%q is not a valid HCL attribute name", k)
+		}
+
+		var v interface{}
+		if err := n.Content[i+1].Decode(&v); err != nil {
+			return err
+		}
+
+		bs, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("attribute %s: %w", k, err)
+		}
+
+		var val ctyjson.SimpleJSONValue
+		if err := val.UnmarshalJSON(bs); err != nil {
+			return fmt.Errorf("attribute %s: %w", k, err)
+		}
+
+		body.SetAttributeValue(k, val.Value)
+	}
+
+	_, err = f.WriteTo(w)
+	return err
+}
+
+// flatEntry is a single key-value pair of a flattened document.
+type flatEntry struct {
+	key   string
+	value string
+}
+
+// flattenNode walks the node depth-first, joining the keys of nested maps
+// and the indices of lists with sep, so that the document can be written
+// to formats that have no notion of nesting.
+func flattenNode(prefix, sep string, n *yaml.Node, entries []flatEntry) ([]flatEntry, error) {
+	join := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + sep + k
+	}
+
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			var err error
+			entries, err = flattenNode(prefix, sep, c, entries)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case yaml.AliasNode:
+		return flattenNode(prefix, sep, n.Alias, entries)
+	case yaml.MappingNode:
+		for i := 0; i < len(n.Content); i += 2 {
+			var err error
+			entries, err = flattenNode(join(n.Content[i].Value), sep, n.Content[i+1], entries)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			var err error
+			entries, err = flattenNode(join(fmt.Sprintf("%d", i)), sep, c, entries)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case yaml.ScalarNode:
+		if prefix == "" {
+			return nil, fmt.Errorf("a map is required at the top level of the document, but got a scalar")
+		}
+		value := n.Value
+		if n.Tag == "!!null" {
+			value = ""
+		}
+		entries = append(entries, flatEntry{key: prefix, value: value})
+	}
+
+	return entries, nil
+}
+
+func encodeDotenv(w io.Writer, node yaml.Node, sep string) error {
+	entries, err := flattenNode("", sep, &node, nil)
+	if err != nil {
+		return fmt.Errorf("%s output: %w", FormatDotenv, err)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		if !dotenvKeyRegexp.MatchString(e.key) {
+			return fmt.Errorf("%q is not a valid dotenv key", e.key)
+		}
+
+		_, _ = fmt.Fprintf(bw, "%s=%s\n", e.key, quoteDotenv(e.value))
+	}
+
+	return bw.Flush()
+}
+
+func encodeProperties(w io.Writer, node yaml.Node, sep string) error {
+	entries, err := flattenNode("", sep, &node, nil)
+	if err != nil {
+		return fmt.Errorf("%s output: %w", FormatProperties, err)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		_, _ = fmt.Fprintf(bw, "%s=%s\n", escapeProperty(e.key, true), escapeProperty(e.value, false))
+	}
+
+	return bw.Flush()
+}
+
+// escapeProperty escapes s as a key or a value of a Java properties file.
+// Non-ASCII characters are written as \uXXXX escapes, so that the result reads back
+// the same regardless of whether the consumer assumes ISO-8859-1 or UTF-8.
+func escapeProperty(s string, isKey bool) string {
+	var sb strings.Builder
+	for i, r := range s {
+		switch r {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '=', ':', '#', '!':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case ' ':
+			// Leading spaces of values and all spaces in keys would otherwise be dropped or end the key
+			if isKey || i == 0 {
+				sb.WriteByte('\\')
+			}
+			sb.WriteRune(r)
+		default:
+			if r < 0x20 || r > 0x7e {
+				for _, u := range utf16.Encode([]rune{r}) {
+					fmt.Fprintf(&sb, `\u%04x`, u)
+				}
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	return sb.String()
+}
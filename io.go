@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -50,6 +52,13 @@ func TextInput(f string) (string, error) {
 }
 
 func Inputs(f string) ([]yaml.Node, error) {
+	return InputsFormat(f, "")
+}
+
+// InputsFormat reads documents in the given format from a file, a directory or stdin.
+// When format is empty, the format of each file is detected from its extension,
+// falling back to YAML.
+func InputsFormat(f, format string) ([]yaml.Node, error) {
 	var reader io.Reader
 	if f == "-" {
 		reader = os.Stdin
@@ -65,21 +74,16 @@ func Inputs(f string) ([]yaml.Node, error) {
 		}
 
 		if info.IsDir() {
-			entries, err := fp.ReadDir(0)
+			_ = fp.Close()
+
+			files, err := InputFiles(f, InputsConfig{Format: format, Recursive: true})
 			if err != nil {
 				return nil, err
 			}
 
 			var nodes []yaml.Node
-
-			for _, e := range entries {
-				s := filepath.Join(f, e.Name())
-				ns, err := Inputs(s)
-				if err != nil {
-					return nil, err
-				}
-
-				nodes = append(nodes, ns...)
+			for _, file := range files {
+				nodes = append(nodes, file.Nodes...)
 			}
 
 			return nodes, nil
@@ -92,27 +96,187 @@ func Inputs(f string) ([]yaml.Node, error) {
 	} else {
 		return nil, fmt.Errorf("Nothing to eval: No file specified")
 	}
+	if format == "" && f != "-" {
+		format = DetectFormat(f)
+	}
+	return nodesFromFormat(reader, format, f)
+}
+
+// InputsConfig customizes how InputFiles reads directories.
+type InputsConfig struct {
+	// Format is the format of all the files. It is detected from the extension of each file when empty.
+	Format string
+	// Include lists the glob patterns of the files to read. All the files are read when empty.
+	// A pattern with a slash matches the path relative to the directory, like "base/*.yaml", and any other pattern matches the file name, like "*.yaml".
+	Include []string
+	// Exclude lists the glob patterns of the files and directories to skip, matched like Include.
+	Exclude []string
+	// Recursive reads the files in the subdirectories too.
+	Recursive bool
+}
+
+// InputFile is a file read by InputFiles.
+type InputFile struct {
+	// Path is the path of the file relative to the directory, with slashes as separators.
+	Path string
+	// Format is the format that the file was read in.
+	Format string
+	Nodes  []yaml.Node
+}
+
+// InputFiles reads the documents of each file in the directory dir, or of dir itself when it is a file, in lexical order.
+// Unlike Inputs, the boundaries of files are kept, so that each file can be written back separately.
+func InputFiles(dir string, c InputsConfig) ([]InputFile, error) {
+	for _, pattern := range append(append([]string(nil), c.Include...), c.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		file, err := inputFile(dir, filepath.Base(dir), c.Format)
+		if err != nil {
+			return nil, err
+		}
+		return []InputFile{file}, nil
+	}
+
+	paths, err := inputPaths(dir, c)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]InputFile, 0, len(paths))
+	for _, rel := range paths {
+		file, err := inputFile(filepath.Join(dir, filepath.FromSlash(rel)), rel, c.Format)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// inputPaths returns the paths of the files selected by c in the directory dir, relative to it, in lexical order.
+func inputPaths(dir string, c InputsConfig) ([]string, error) {
+	var paths []string
+	var walk func(rel string) error
+	walk = func(rel string) error {
+		entries, err := os.ReadDir(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			r := path.Join(rel, e.Name())
+			if matchInputPath(c.Exclude, r) {
+				continue
+			}
+
+			// Stat follows symlinks, so that linked directories are read like they were before.
+			info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(r)))
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if c.Recursive {
+					if err := walk(r); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			if len(c.Include) > 0 && !matchInputPath(c.Include, r) {
+				continue
+			}
+
+			paths = append(paths, r)
+		}
+		return nil
+	}
+	if err := walk(""); err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+func inputFile(f, rel, format string) (InputFile, error) {
+	if format == "" {
+		format = DetectFormat(f)
+	}
+
+	fp, err := os.Open(f)
+	if err != nil {
+		return InputFile{}, err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+
+	nodes, err := nodesFromFormat(fp, format, f)
+	if err != nil {
+		return InputFile{}, fmt.Errorf("reading %s: %w", f, err)
+	}
+
+	return InputFile{Path: rel, Format: format, Nodes: nodes}, nil
+}
+
+// matchInputPath reports whether the relative path rel matches any of the patterns, as documented in InputsConfig.
+func matchInputPath(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := path.Base(rel)
+		if strings.Contains(pattern, "/") {
+			name = rel
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// NodesFromReader reads the YAML documents of reader like Inputs does,
+// keeping date-like values such as 2024-01-01 as strings so that they are written back as they are.
+func NodesFromReader(reader io.Reader) ([]yaml.Node, error) {
 	return nodesFromReader(reader)
 }
 
 func nodesFromReader(reader io.Reader) ([]yaml.Node, error) {
 	nodes := []yaml.Node{}
-	buf := bufio.NewReader(reader)
-	decoder := yaml.NewDecoder(buf)
+	err := decodeDocuments(reader, func(node yaml.Node) error {
+		nodes = append(nodes, node)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// decodeDocuments calls fn with each YAML document read from reader, as soon as it is decoded.
+func decodeDocuments(reader io.Reader, fn func(yaml.Node) error) error {
+	decoder := yaml.NewDecoder(bufio.NewReader(reader))
 	for {
 		node := yaml.Node{}
 		if err := decoder.Decode(&node); err != nil {
 			if err != io.EOF {
-				return nil, err
+				return err
 			}
-			break
+			return nil
 		}
-		if len(node.Content[0].Content) > 0 {
-			replaceTimestamp(&node)
-			nodes = append(nodes, node)
+		// Empty documents are kept, so that the documents of the output match those of the input.
+		replaceTimestamp(&node)
+		if err := fn(node); err != nil {
+			return err
 		}
 	}
-	return nodes, nil
 }
 
 // A custom unmarshal is needed because go-yaml parse "YYYY-MM-DD" as a full
@@ -134,19 +298,100 @@ func replaceTimestamp(n *yaml.Node) {
 	}
 }
 
-func Output(output io.Writer, format string, nodes []yaml.Node) error {
+// OutputConfig customizes how Output writes documents.
+type OutputConfig struct {
+	// Separator joins the keys of nested maps and the indices of lists
+	// into a single key for formats that are flat, i.e. dotenv and properties.
+	// Defaults to "_" for dotenv and "." for properties.
+	Separator string
+}
+
+// Output writes the documents in the given format, which is one of OutputFormats.
+// Any other format, including an empty one, means YAML.
+func Output(output io.Writer, format string, nodes []yaml.Node, config ...OutputConfig) error {
+	var c OutputConfig
+	if len(config) > 0 {
+		c = config[0]
+	}
+
+	switch format {
+	case FormatTOML, FormatHCL, FormatTFVars, FormatDotenv, FormatProperties:
+		var n int
+		for _, node := range nodes {
+			if !isEmptyDocument(node) {
+				n++
+			}
+		}
+		if n > 1 {
+			return fmt.Errorf("%s output does not support multiple documents: got %d", format, n)
+		}
+	}
+
+	// JSON has no empty document, so that the ones left by a trailing "---" or only comments are dropped
+	// along with their separators, rather than written as null.
+	if format == FormatJSON || format == FormatJSON5 {
+		var nonEmpty []yaml.Node
+		for _, node := range nodes {
+			if !isEmptyDocument(node) {
+				nonEmpty = append(nonEmpty, node)
+			}
+		}
+		nodes = nonEmpty
+	}
+
+	separator := func(def string) string {
+		if c.Separator != "" {
+			return c.Separator
+		}
+		return def
+	}
+
 	for i, node := range nodes {
+		switch format {
+		case FormatTOML, FormatHCL, FormatTFVars, FormatDotenv, FormatProperties:
+			// There is nothing to write for a file without any content, like one with only comments.
+			if isEmptyDocument(node) {
+				continue
+			}
+		}
+
+		switch format {
+		case FormatTOML:
+			if err := encodeTOML(output, node); err != nil {
+				return err
+			}
+			continue
+		case FormatHCL, FormatTFVars:
+			if err := encodeHCL(output, node); err != nil {
+				return err
+			}
+			continue
+		case FormatDotenv:
+			if err := encodeDotenv(output, node, separator("_")); err != nil {
+				return err
+			}
+			continue
+		case FormatProperties:
+			if err := encodeProperties(output, node, separator(".")); err != nil {
+				return err
+			}
+			continue
+		}
+
 		var v interface{}
 		if err := node.Decode(&v); err != nil {
 			return err
 		}
-		if format == "json" {
+		switch {
+		case format == FormatJSON || format == FormatJSON5:
 			bs, err := json.Marshal(v)
 			if err != nil {
 				return err
 			}
 			_, _ = fmt.Fprintln(output, string(bs))
-		} else {
+		case isEmptyDocument(node):
+			// Written as an empty document rather than null, so that it round-trips.
+		default:
 			encoder := yaml.NewEncoder(output)
 			encoder.SetIndent(2)
 
@@ -2,6 +2,9 @@ package vals
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -30,6 +33,12 @@ func Test_InputOutput(t *testing.T) {
 			format:   "yaml",
 			expected: "foo:\n  bar:\n    - baz\n---\nbar: baz\n",
 		},
+		{
+			name:     "empty and scalar documents yaml",
+			input:    baseDocument + "---\n---\nfoo\n---\n42\n",
+			format:   "yaml",
+			expected: "foo:\n  bar:\n    - baz\n---\n---\nfoo\n---\n42\n",
+		},
 		{
 			name:     "single document json",
 			input:    baseDocument,
@@ -100,17 +109,17 @@ func Test_NodesFromReader(t *testing.T) {
 		{
 			name:  "single comment document",
 			input: commentDocument,
-			nodes: 0,
+			nodes: 1,
 		},
 		{
 			name:  "multiple comment document",
 			input: commentDocument + commentDocument,
-			nodes: 0,
+			nodes: 2,
 		},
 		{
 			name:  "mixed documents",
 			input: simpleDocument + commentDocument,
-			nodes: 1,
+			nodes: 2,
 		},
 	}
 
@@ -127,3 +136,245 @@ func Test_NodesFromReader(t *testing.T) {
 		})
 	}
 }
+
+func Test_OutputJSONEmptyDocuments(t *testing.T) {
+	for _, input := range []string{
+		"a: x\n---\n",
+		"a: x\n---\n# comment\n",
+		"# comment\n---\na: x\n---\n",
+	} {
+		nodes, err := nodesFromReader(strings.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		if err := Output(&out, FormatJSON, nodes); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := "{\"a\":\"x\"}\n"; out.String() != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, input, out.String())
+		}
+	}
+}
+
+func Test_InputOutputFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		format   string
+		expected string
+	}{
+		{
+			name:     "toml",
+			input:    "title = \"ref+echo://foo/bar\"\n\n[db]\nport = 5432\n",
+			format:   FormatTOML,
+			expected: "title = \"foo/bar\"\n\n[db]\n  port = 5432\n",
+		},
+		{
+			name:     "hcl",
+			input:    "region = \"ref+echo://foo/bar#/foo\"\nports = [80, 443]\n",
+			format:   FormatHCL,
+			expected: "ports  = [80, 443]\nregion = \"bar\"\n",
+		},
+		{
+			name:     "dotenv",
+			input:    "# comment\nexport A=ref+echo://foo/bar\nB=\"multi\nline\"\nC='x y'\nD=plain # comment\n",
+			format:   FormatDotenv,
+			expected: "A=foo/bar\nB=\"multi\\nline\"\nC='x y'\nD=plain\n",
+		},
+		{
+			name:     "json5",
+			input:    "{\n  // comment\n  key: 'ref+echo://foo/bar', /* inline */\n  \"url\": \"http://x//y\",\n}\n",
+			format:   FormatJSON5,
+			expected: "{\"key\":\"foo/bar\",\"url\":\"http://x//y\"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := nodesFromFormat(strings.NewReader(tt.input), tt.format, tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nodes, err = EvalNodes(nodes, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := &bytes.Buffer{}
+			if err := Output(buf, tt.format, nodes); err != nil {
+				t.Fatal(err)
+			}
+
+			if buf.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func Test_DetectFormat(t *testing.T) {
+	tests := map[string]string{
+		"values.yaml":         FormatYAML,
+		"values.json":         FormatJSON,
+		"settings.jsonc":      FormatJSON5,
+		"app.toml":            FormatTOML,
+		"prod.auto.tfvars":    FormatHCL,
+		".env":                FormatDotenv,
+		"dir/.env.production": FormatDotenv,
+		"prod.env":            FormatDotenv,
+		"README":              FormatYAML,
+	}
+
+	for path, expected := range tests {
+		if got := DetectFormat(path); got != expected {
+			t.Errorf("DetectFormat(%q): expected %q, got %q", path, expected, got)
+		}
+	}
+}
+
+func Test_OutputFlatFormats(t *testing.T) {
+	input := `db:
+  host: db.local
+  password: "multi\nline \"q\" $X é"
+items: [a, 1, true]
+`
+
+	tests := []struct {
+		format    string
+		separator string
+		expected  string
+	}{
+		{
+			format:   FormatDotenv,
+			expected: "db_host=db.local\ndb_password=\"multi\\nline \\\"q\\\" \\$X é\"\nitems_0=a\nitems_1=1\nitems_2=true\n",
+		},
+		{
+			format:    FormatDotenv,
+			separator: "__",
+			expected:  "db__host=db.local\ndb__password=\"multi\\nline \\\"q\\\" \\$X é\"\nitems__0=a\nitems__1=1\nitems__2=true\n",
+		},
+		{
+			format:   FormatProperties,
+			expected: "db.host=db.local\ndb.password=multi\\nline \"q\" $X \\u00e9\nitems.0=a\nitems.1=1\nitems.2=true\n",
+		},
+		{
+			format:   FormatTFVars,
+			expected: "db = {\n  host     = \"db.local\"\n  password = \"multi\\nline \\\"q\\\" $X é\"\n}\nitems = [\"a\", 1, true]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format+tt.separator, func(t *testing.T) {
+			nodes, err := nodesFromReader(strings.NewReader(input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := &bytes.Buffer{}
+			if err := Output(buf, tt.format, nodes, OutputConfig{Separator: tt.separator}); err != nil {
+				t.Fatal(err)
+			}
+
+			if buf.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func Test_InputFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"app.yaml":         "a: 1\n",
+		"README.md":        "# readme\n",
+		"base/b.json":      `{"b": 2}`,
+		"base/c.toml":      "c = 3\n",
+		"vendor/v.yaml":    "v: 4\n",
+		"base/sub/d.yaml":  "d: 5\n",
+		"base/sub/e.yml":   "e: 6\n",
+		"base/sub/f.yaml~": "f: 7\n",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		config   InputsConfig
+		expected []string
+	}{
+		{
+			name:     "not recursive",
+			config:   InputsConfig{},
+			expected: []string{"README.md", "app.yaml"},
+		},
+		{
+			name:     "recursive",
+			config:   InputsConfig{Recursive: true},
+			expected: []string{"README.md", "app.yaml", "base/b.json", "base/c.toml", "base/sub/d.yaml", "base/sub/e.yml", "base/sub/f.yaml~", "vendor/v.yaml"},
+		},
+		{
+			name:     "include file names",
+			config:   InputsConfig{Recursive: true, Include: []string{"*.yaml", "*.json"}},
+			expected: []string{"app.yaml", "base/b.json", "base/sub/d.yaml", "vendor/v.yaml"},
+		},
+		{
+			name:     "include paths",
+			config:   InputsConfig{Recursive: true, Include: []string{"base/*"}},
+			expected: []string{"base/b.json", "base/c.toml"},
+		},
+		{
+			name:     "exclude directories",
+			config:   InputsConfig{Recursive: true, Include: []string{"*.yaml"}, Exclude: []string{"vendor", "base/sub"}},
+			expected: []string{"app.yaml"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := InputFiles(dir, tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var paths []string
+			for _, f := range files {
+				paths = append(paths, f.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, paths)
+			}
+		})
+	}
+
+	t.Run("formats", func(t *testing.T) {
+		files, err := InputFiles(filepath.Join(dir, "base"), InputsConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 2 || files[0].Format != FormatJSON || files[1].Format != FormatTOML {
+			t.Fatalf("Unexpected files: %+v", files)
+		}
+
+		buf := &bytes.Buffer{}
+		if err := Output(buf, files[1].Format, files[1].Nodes); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "c = 3\n" {
+			t.Errorf("Expected %q, got %q", "c = 3\n", buf.String())
+		}
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := InputFiles(dir, InputsConfig{Include: []string{"["}})
+		if err == nil || err.Error() != `invalid pattern "[": syntax error in pattern` {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
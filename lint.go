@@ -0,0 +1,317 @@
+package vals
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/helmfile/vals/pkg/expansion"
+	"github.com/helmfile/vals/pkg/providers/plugin"
+	"github.com/helmfile/vals/pkg/providers/registry"
+)
+
+// LintIssue is a problem found in a ref expression by Lint.
+type LintIssue struct {
+	File    string
+	Line    int
+	Column  int
+	Ref     string
+	Message string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", i.File, i.Line, i.Column, i.Message)
+}
+
+// refPrefixRegexp finds the start of every ref expression, including nested ones.
+var refPrefixRegexp = regexp.MustCompile(`(secret)?ref\+`)
+
+func isProviderAvailable(scheme string) bool {
+	if _, ok := registry.GetProvider(scheme); ok {
+		return true
+	}
+	_, ok := plugin.Find(scheme, plugin.Dirs())
+	return ok
+}
+
+func availableProviders() []string {
+	var schemes []string
+	for _, m := range registry.Providers() {
+		schemes = append(schemes, m.Scheme)
+	}
+	return schemes
+}
+
+// maxLintLineSize is the length of the longest line Lint can scan.
+var maxLintLineSize = 16 * 1024 * 1024
+
+// binarySniffSize is how many leading bytes of a file are checked for a NUL byte,
+// which marks it as binary, like git does.
+const binarySniffSize = 8000
+
+// LintFile runs Lint over the file, or over every file within the directory.
+// Binary files are skipped.
+func LintFile(path string) ([]LintIssue, error) {
+	var issues []LintIssue
+
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+
+		br := bufio.NewReaderSize(f, binarySniffSize)
+		head, err := br.Peek(binarySniffSize)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if bytes.IndexByte(head, 0) >= 0 {
+			return nil
+		}
+
+		is, err := Lint(br, p)
+		if err != nil {
+			return err
+		}
+		issues = append(issues, is...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return issues, nil
+}
+
+// Lint finds every ref expression in the text read from r and validates it
+// without contacting any backend: the provider must be available in this build,
+// the query parameters must be known to the provider and valid for their types,
+// required ones must be set, and the fragment must be a well-formed path supported by the provider.
+// A line too long to be scanned is reported as an issue, and ends the linting of the text.
+func Lint(r io.Reader, filename string) ([]LintIssue, error) {
+	var issues []LintIssue
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, min(64*1024, maxLintLineSize)), maxLintLineSize)
+
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+
+		for _, loc := range refPrefixRegexp.FindAllStringIndex(line, -1) {
+			ixs := expansion.DefaultRefRegexp.FindStringSubmatchIndex(line[loc[0]:])
+			if ixs == nil || ixs[0] != 0 {
+				continue
+			}
+			ref := line[loc[0]+ixs[6] : loc[0]+ixs[7]]
+
+			for _, msg := range lintRef(ref) {
+				issues = append(issues, LintIssue{
+					File:    filename,
+					Line:    lineNo,
+					Column:  loc[0] + 1,
+					Ref:     line[loc[0] : loc[0]+ixs[1]],
+					Message: msg,
+				})
+			}
+		}
+	}
+	if err := scanner.Err(); errors.Is(err, bufio.ErrTooLong) {
+		issues = append(issues, LintIssue{
+			File:    filename,
+			Line:    lineNo + 1,
+			Column:  1,
+			Message: fmt.Sprintf("line longer than %d bytes, the rest of the file is not linted", maxLintLineSize),
+		})
+	} else if err != nil {
+		return nil, err
+	}
+
+	return issues, nil
+}
+
+// lintRef validates the <provider>://<path>[?params][#fragment] part of a ref expression.
+func lintRef(ref string) []string {
+	scheme, _, ok := strings.Cut(ref, "://")
+	if !ok {
+		return []string{fmt.Sprintf("malformed ref %q: expected <provider>://<path>", ref)}
+	}
+
+	if !isProviderAvailable(scheme) {
+		msg := fmt.Sprintf("unknown provider %q", scheme)
+		if s := suggest(scheme, availableProviders()); s != "" {
+			msg += fmt.Sprintf(" (did you mean %q?)", s)
+		}
+		return []string{msg}
+	}
+
+	// The parameters and the fragment of a ref containing nested refs
+	// are only known once the nested refs are resolved.
+	if refPrefixRegexp.MatchString(ref) {
+		return nil
+	}
+
+	var msgs []string
+
+	uri, err := parseRefURI(ref)
+	if err != nil {
+		return []string{fmt.Sprintf("malformed ref %q: %v", ref, err)}
+	}
+
+	query, err := url.ParseQuery(uri.RawQuery)
+	if err != nil {
+		msgs = append(msgs, fmt.Sprintf("malformed query parameters: %v", err))
+	}
+
+	// Providers registered without metadata accept any parameter.
+	meta, described := registry.Describe(scheme)
+	if described {
+		var names []string
+		for name := range query {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			p, ok := meta.Param(name)
+			if !ok {
+				msg := fmt.Sprintf("unknown parameter %q for provider %q", name, scheme)
+				if s := suggest(name, paramNames(meta)); s != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", s)
+				}
+				msgs = append(msgs, msg)
+				continue
+			}
+			if msg := lintParamValue(p, query.Get(name)); msg != "" {
+				msgs = append(msgs, fmt.Sprintf("invalid value %q for parameter %q of provider %q: %s", query.Get(name), name, scheme, msg))
+			}
+		}
+
+		for _, p := range meta.Params {
+			if p.Required && query.Get(p.Name) == "" && !isParamInEnv(p) {
+				msgs = append(msgs, fmt.Sprintf("missing required parameter %q for provider %q", p.Name, scheme))
+			}
+		}
+	}
+
+	if strings.Count(ref, "#") > 1 {
+		msgs = append(msgs, "malformed fragment: more than one \"#\"")
+	} else if _, frag, ok := strings.Cut(ref, "#"); ok {
+		if described && !meta.Capabilities.Fragment {
+			msgs = append(msgs, fmt.Sprintf("provider %q does not support fragments", scheme))
+		}
+		frag = strings.TrimPrefix(frag, "/")
+		if frag == "" {
+			msgs = append(msgs, "malformed fragment: empty path")
+		} else {
+			for _, k := range strings.Split(frag, "/") {
+				if k == "" {
+					msgs = append(msgs, fmt.Sprintf("malformed fragment %q: empty key", frag))
+					break
+				}
+			}
+		}
+	}
+
+	return msgs
+}
+
+func paramNames(meta registry.Metadata) []string {
+	var names []string
+	for _, p := range meta.Params {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// isParamInEnv reports whether the parameter is set via one of the environment variables the provider falls back to.
+func isParamInEnv(p registry.Param) bool {
+	if os.Getenv(EnvFallbackPrefix+strings.ToUpper(p.Name)) != "" {
+		return true
+	}
+	for _, e := range p.Env {
+		if os.Getenv(e) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// lintParamValue checks the value against the type of the parameter,
+// returning a description of the problem or an empty string.
+func lintParamValue(p registry.Param, v string) string {
+	switch p.Type {
+	case "bool":
+		if _, err := strconv.ParseBool(v); err != nil {
+			return "expected a boolean"
+		}
+	case "flag":
+		if b, err := strconv.ParseBool(v); err == nil && !b {
+			return "the parameter is enabled by its presence whatever its value, omit it instead"
+		}
+	case "int":
+		if _, err := strconv.Atoi(v); err != nil {
+			return "expected an integer"
+		}
+	case "enum":
+		for _, allowed := range p.Values {
+			if v == allowed {
+				return ""
+			}
+		}
+		return fmt.Sprintf("expected one of %s", strings.Join(p.Values, ", "))
+	}
+	return ""
+}
+
+// suggest returns the candidate closest to s, if it is close enough to be a likely typo.
+func suggest(s string, candidates []string) string {
+	best, bestDist := "", 3
+	for _, c := range candidates {
+		if d := levenshtein(s, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,71 @@
+package vals
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	input := `ok: ref+echo://foo/bar#/foo
+typo: ref+vualt://kv/db#/password
+param: ref+awsssm://foo?regoin=us-east-1
+required: ref+gkms://xxx?project=p&location=l&keyring=k
+fragment: ref+echo://foo/bar#/a//b
+prefixed: ref+exec://cmd?env_FOO=1&timeout=3
+nested: ref+echo://ref+envsubst://$X/y
+enum: ref+vault://kv/db?decode=hex#/password
+unsupported: ref+tfstate://terraform.tfstate/output.foo#/bar
+flag: ref+k8s://v1/Secret/ns/name/key?inCluster
+flagfalse: ref+k8s://v1/Secret/ns/name/key?inCluster=false
+`
+
+	issues, err := Lint(strings.NewReader(input), "values.yaml")
+	require.NoError(t, err)
+
+	var got []string
+	for _, i := range issues {
+		got = append(got, i.String())
+	}
+
+	require.Equal(t, []string{
+		`values.yaml:2:7: unknown provider "vualt" (did you mean "vault"?)`,
+		`values.yaml:3:8: unknown parameter "regoin" for provider "awsssm" (did you mean "region"?)`,
+		`values.yaml:4:11: missing required parameter "crypto_key" for provider "gkms"`,
+		`values.yaml:5:11: malformed fragment "a//b": empty key`,
+		`values.yaml:8:7: invalid value "hex" for parameter "decode" of provider "vault": expected one of raw, base64`,
+		`values.yaml:9:14: provider "tfstate" does not support fragments`,
+		`values.yaml:11:12: invalid value "false" for parameter "inCluster" of provider "k8s": the parameter is enabled by its presence whatever its value, omit it instead`,
+	}, got)
+}
+
+func TestLintFile(t *testing.T) {
+	defer func(n int) { maxLintLineSize = n }(maxLintLineSize)
+	maxLintLineSize = 64
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.yaml":   "typo: ref+vualt://kv/db#/password\n",
+		"bin":      "\x00\x01typo: ref+vualt://kv/db#/password\n",
+		"long.txt": "ok: ref+echo://foo/bar#/foo\n" + strings.Repeat("x", 100) + "\ntypo: ref+vualt://kv/db#/password\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+
+	issues, err := LintFile(dir)
+	require.NoError(t, err)
+
+	var got []string
+	for _, i := range issues {
+		got = append(got, i.String())
+	}
+
+	require.Equal(t, []string{
+		filepath.Join(dir, "a.yaml") + `:1:7: unknown provider "vualt" (did you mean "vault"?)`,
+		filepath.Join(dir, "long.txt") + `:2:1: line longer than 64 bytes, the rest of the file is not linted`,
+	}, got)
+}
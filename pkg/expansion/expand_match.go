@@ -11,6 +11,11 @@ type ExpandRegexMatch struct {
 	Target *regexp.Regexp
 	Lookup func(string) (interface{}, error)
 	Only   []string
+	// Render, when set, turns each value substituted by InString into text.
+	// before and after are the text surrounding the expression being replaced,
+	// so that the value can be escaped for the syntax it is embedded in.
+	// Values are formatted with %v otherwise.
+	Render func(val interface{}, before, after string) (string, error)
 }
 
 var DefaultRefRegexp = regexp.MustCompile(`((secret)?ref)\+([^\+:]*:\/\/[^\+\n ]+[^\+\n ",])\+?`)
@@ -60,7 +65,7 @@ func (e *ExpandRegexMatch) resolveInnerRefs(s string, depth int) (string, error)
 		ref := substring[ixs[6]:ixs[7]]
 		val, err := e.Lookup(ref)
 		if err != nil {
-			return "", fmt.Errorf("expand %s: %v", ref, err)
+			return "", fmt.Errorf("expand %s: %w", ref, err)
 		}
 
 		// Nested refs become part of an outer URI, so they must resolve to scalar values.
@@ -93,28 +98,38 @@ func (e *ExpandRegexMatch) InString(s string) (string, error) {
 	}
 
 	var sb strings.Builder
+	pos := 0
 	for {
-		ixs := e.Target.FindStringSubmatchIndex(s)
+		rest := s[pos:]
+		ixs := e.Target.FindStringSubmatchIndex(rest)
 		if ixs == nil {
-			sb.WriteString(s)
+			sb.WriteString(rest)
 			return sb.String(), nil
 		}
 
-		kind := s[ixs[2]:ixs[3]]
+		kind := rest[ixs[2]:ixs[3]]
 		if !e.shouldExpand(kind) {
-			sb.WriteString(s)
+			sb.WriteString(rest)
 			// FIXME: this skips the rest of the string, is this intended?
 			return sb.String(), nil
 		}
 
-		ref := s[ixs[6]:ixs[7]]
+		ref := rest[ixs[6]:ixs[7]]
 		val, err := e.Lookup(ref)
 		if err != nil {
-			return "", fmt.Errorf("expand %s: %v", ref, err)
+			return "", fmt.Errorf("expand %s: %w", ref, err)
+		}
+		sb.WriteString(rest[:ixs[0]])
+		if e.Render != nil {
+			str, err := e.Render(val, sb.String(), rest[ixs[1]:])
+			if err != nil {
+				return "", fmt.Errorf("expand %s: %w", ref, err)
+			}
+			sb.WriteString(str)
+		} else {
+			fmt.Fprintf(&sb, "%v", val)
 		}
-		sb.WriteString(s[:ixs[0]])
-		fmt.Fprintf(&sb, "%v", val)
-		s = s[ixs[1]:]
+		pos += ixs[1]
 	}
 }
 
@@ -142,7 +157,7 @@ func (e *ExpandRegexMatch) InValue(s string) (interface{}, error) {
 		}
 		val, err := e.Lookup(ref)
 		if err != nil {
-			return nil, fmt.Errorf("expand %s: %v", ref, err)
+			return nil, fmt.Errorf("expand %s: %w", ref, err)
 		}
 		return val, nil
 	// Partial match, expand as string
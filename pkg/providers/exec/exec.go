@@ -73,6 +73,12 @@ func defaultExecutor(ctx context.Context, name string, args []string, env []stri
 	return stdout.Bytes(), stderr.Bytes(), err
 }
 
+// Command returns the command that the provider runs for the path of a ref.
+func Command(key string) string {
+	cmd, _ := parseCommand(strings.TrimSuffix(key, "/"))
+	return cmd
+}
+
 func parseCommand(key string) (string, []string) {
 	if key == "" {
 		return "", nil
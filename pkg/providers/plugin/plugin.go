@@ -0,0 +1,372 @@
+// Package plugin runs providers implemented outside of vals.
+//
+// A plugin for the scheme <scheme> is either a WebAssembly module named vals-provider-<scheme>.wasm,
+// found in one of the plugin directories, or an executable named vals-provider-<scheme>,
+// found in one of the plugin directories or on PATH.
+// vals starts it once per scheme and Runtime, and exchanges JSON-RPC 2.0 messages with it:
+// newline-delimited over the stdin and stdout of executables, and as described in HostModule for WebAssembly modules.
+// The methods are:
+//
+//   - describe: params {"protocolVersion": 1}, result {"protocolVersion": 1, "metadata": {...}},
+//     where metadata is a registry.Metadata. It is the first call made to every plugin.
+//   - getString: params {"path": "...", "params": {...}}, result "..."
+//   - getStringMap: params {"path": "...", "params": {...}}, result {...}
+//
+// path is the part of the ref between "://" and the query, and params are its query parameters.
+// Anything the plugin writes to stderr is passed through to the log output given to Start.
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/helmfile/vals/pkg/api"
+	"github.com/helmfile/vals/pkg/providers/registry"
+)
+
+const (
+	// ProtocolVersion is the version of the protocol spoken by this version of vals.
+	ProtocolVersion = 1
+
+	// ExecutablePrefix is prepended to the scheme to get the name of the plugin executable.
+	ExecutablePrefix = "vals-provider-"
+
+	// DirsEnv is the environment variable listing the plugin directories, separated like PATH.
+	DirsEnv = "VALS_PLUGINS_DIR"
+)
+
+var (
+	// CallTimeout bounds each call to a plugin, which is stopped when it does not answer in time.
+	// The plugin cannot be called anymore once stopped.
+	CallTimeout = time.Minute
+
+	// CloseTimeout is how long Close waits for an executable plugin to exit once its stdin is closed,
+	// before killing it.
+	CloseTimeout = 5 * time.Second
+)
+
+// Dirs returns the plugin directories listed in DirsEnv.
+func Dirs() []string {
+	return filepath.SplitList(os.Getenv(DirsEnv))
+}
+
+// Find returns the path to the plugin for the scheme, looking into dirs first and then on PATH.
+// WebAssembly modules are preferred over executables in the same directory.
+func Find(scheme string, dirs []string) (string, bool) {
+	if scheme == "" || strings.ContainsAny(scheme, `/\`) {
+		return "", false
+	}
+
+	name := ExecutablePrefix + scheme
+
+	for _, d := range dirs {
+		if d == "" {
+			continue
+		}
+		path := filepath.Join(d, name+WasmExtension)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+		path = filepath.Join(d, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() && info.Mode()&0o111 != 0 {
+			return path, true
+		}
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+type request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int         `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int             `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *Error          `json:"error"`
+}
+
+// Error is a JSON-RPC error returned by a plugin.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+type describeParams struct {
+	ProtocolVersion int `json:"protocolVersion"`
+}
+
+type describeResult struct {
+	ProtocolVersion int               `json:"protocolVersion"`
+	Metadata        registry.Metadata `json:"metadata"`
+}
+
+type getParams struct {
+	Path   string            `json:"path"`
+	Params map[string]string `json:"params"`
+}
+
+// transport carries the requests of a Client to a plugin.
+type transport interface {
+	// roundTrip sends a request and returns the response, both encoded as JSON.
+	roundTrip(req []byte) ([]byte, error)
+	close() error
+}
+
+// Client is a running plugin.
+type Client struct {
+	scheme string
+	meta   registry.Metadata
+	t      transport
+
+	m      sync.Mutex
+	nextID int
+	closed bool
+}
+
+// Start runs the plugin at path for the scheme, and checks that it speaks ProtocolVersion.
+// Plugins ending with ".wasm" are run in a sandbox that only grants them perms,
+// while executables are run as they are.
+// The logs of the plugin are written to logOut, or to os.Stderr when it is nil.
+func Start(scheme, path string, perms Permissions, logOut io.Writer) (*Client, error) {
+	if logOut == nil {
+		logOut = os.Stderr
+	}
+
+	var (
+		t   transport
+		err error
+	)
+	if strings.HasSuffix(path, WasmExtension) {
+		t, err = startWasm(scheme, path, perms, logOut)
+	} else {
+		t, err = startExecutable(path, logOut)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		scheme: scheme,
+		t:      t,
+	}
+
+	var res describeResult
+	if err := c.call("describe", describeParams{ProtocolVersion: ProtocolVersion}, &res); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	if res.ProtocolVersion != ProtocolVersion {
+		_ = c.Close()
+		return nil, fmt.Errorf("plugin %s speaks protocol version %d, but vals speaks %d", path, res.ProtocolVersion, ProtocolVersion)
+	}
+
+	c.meta = res.Metadata
+	c.meta.Scheme = scheme
+
+	return c, nil
+}
+
+// Describe returns the metadata the plugin reported on startup.
+func (c *Client) Describe() registry.Metadata {
+	return c.meta
+}
+
+// Provider returns a provider that passes params to the plugin along with every path.
+func (c *Client) Provider(params map[string]string) api.Provider {
+	return &provider{client: c, params: params}
+}
+
+// Close stops the plugin.
+func (c *Client) Close() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	if err := c.t.close(); err != nil {
+		return fmt.Errorf("plugin for %q: %w", c.scheme, err)
+	}
+	return nil
+}
+
+func (c *Client) call(method string, params interface{}, result interface{}) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.closed {
+		return fmt.Errorf("plugin for %q: already closed", c.scheme)
+	}
+
+	c.nextID++
+	req := request{JSONRPC: "2.0", ID: c.nextID, Method: method, Params: params}
+
+	bs, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	out, err := c.t.roundTrip(bs)
+	if err != nil {
+		return fmt.Errorf("plugin for %q: %s: %w", c.scheme, method, err)
+	}
+
+	var res response
+	if err := json.Unmarshal(out, &res); err != nil {
+		return fmt.Errorf("plugin for %q: malformed %s response: %w", c.scheme, method, err)
+	}
+	if res.ID != req.ID {
+		return fmt.Errorf("plugin for %q: unexpected response id %d to %s request %d", c.scheme, res.ID, method, req.ID)
+	}
+	if res.Error != nil {
+		return fmt.Errorf("plugin for %q: %s: %w", c.scheme, method, res.Error)
+	}
+
+	if err := json.Unmarshal(res.Result, result); err != nil {
+		return fmt.Errorf("plugin for %q: unexpected %s result: %w", c.scheme, method, err)
+	}
+
+	return nil
+}
+
+// executable exchanges newline-delimited messages with a plugin process over its stdin and stdout.
+type executable struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	// killed is set once the plugin is killed for not answering in time.
+	killed bool
+}
+
+func startExecutable(path string, logOut io.Writer) (*executable, error) {
+	cmd := exec.Command(path)
+	cmd.Stderr = logOut
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting plugin %s: %w", path, err)
+	}
+
+	return &executable{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+	}, nil
+}
+
+// roundTrip sends the request and waits for the response up to CallTimeout, killing the plugin past it.
+func (e *executable) roundTrip(req []byte) ([]byte, error) {
+	if e.killed {
+		return nil, errors.New("killed after not responding in time")
+	}
+
+	type result struct {
+		line []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		line, err := e.exchange(req)
+		done <- result{line, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.line, r.err
+	case <-time.After(CallTimeout):
+		e.killed = true
+		_ = e.cmd.Process.Kill()
+		<-done
+		return nil, fmt.Errorf("killed after not responding within %s", CallTimeout)
+	}
+}
+
+func (e *executable) exchange(req []byte) ([]byte, error) {
+	if _, err := e.stdin.Write(append(req, '\n')); err != nil {
+		return nil, fmt.Errorf("writing request: %w", err)
+	}
+
+	line, err := e.stdout.ReadBytes('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("exited before responding")
+		}
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+
+	return line, nil
+}
+
+// close closes the stdin of the plugin, which is expected to exit, and waits for it up to CloseTimeout.
+func (e *executable) close() error {
+	_ = e.stdin.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- e.cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		if e.killed {
+			// The failure was already reported by the call that timed out.
+			return nil
+		}
+		return err
+	case <-time.After(CloseTimeout):
+		_ = e.cmd.Process.Kill()
+		<-done
+		return fmt.Errorf("killed after not exiting within %s of its stdin being closed", CloseTimeout)
+	}
+}
+
+type provider struct {
+	client *Client
+	params map[string]string
+}
+
+func (p *provider) GetString(key string) (string, error) {
+	var s string
+	if err := p.client.call("getString", getParams{Path: key, Params: p.params}, &s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+func (p *provider) GetStringMap(key string) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := p.client.call("getStringMap", getParams{Path: key, Params: p.params}, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,186 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestHelperPlugin is not a real test: it is run as the plugin by the other tests,
+// through the script written by writePlugin.
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv("VALS_TEST_HELPER_PLUGIN") != "1" {
+		t.Skip("helper process")
+	}
+
+	version := ProtocolVersion
+	if v := os.Getenv("VALS_TEST_HELPER_PLUGIN_VERSION"); v != "" {
+		_, _ = fmt.Sscan(v, &version)
+	}
+
+	in := bufio.NewScanner(os.Stdin)
+	out := json.NewEncoder(os.Stdout)
+	for in.Scan() {
+		var req struct {
+			ID     int             `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(in.Bytes(), &req); err != nil {
+			os.Exit(2)
+		}
+
+		res := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+
+		var params getParams
+		_ = json.Unmarshal(req.Params, &params)
+
+		switch req.Method {
+		case "describe":
+			res["result"] = map[string]interface{}{
+				"protocolVersion": version,
+				"metadata": map[string]interface{}{
+					"description":  "Test plugin",
+					"capabilities": map[string]bool{"stringMap": true, "fragment": true},
+				},
+			}
+		case "getString":
+			switch params.Path {
+			case "missing":
+				res["error"] = map[string]interface{}{"code": 1, "message": "not found"}
+			case "hang":
+				time.Sleep(time.Hour)
+			case "log":
+				fmt.Fprintln(os.Stderr, "log from the plugin")
+				res["result"] = "logged"
+			default:
+				res["result"] = params.Path + "-" + params.Params["suffix"]
+			}
+		case "getStringMap":
+			res["result"] = map[string]interface{}{"path": params.Path}
+		default:
+			res["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+		}
+
+		_ = out.Encode(res)
+	}
+	if os.Getenv("VALS_TEST_HELPER_PLUGIN_HANG") == "1" {
+		time.Sleep(time.Hour)
+	}
+	os.Exit(0)
+}
+
+// writePlugin writes a vals-provider-<scheme> script into a temporary directory,
+// which runs this test binary as the plugin.
+func writePlugin(t *testing.T, scheme string, env ...string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	script := "#!/bin/sh\nexport VALS_TEST_HELPER_PLUGIN=1\n"
+	for _, e := range env {
+		script += "export " + e + "\n"
+	}
+	script += fmt.Sprintf("exec %q -test.run='^TestHelperPlugin$'\n", os.Args[0])
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ExecutablePrefix+scheme), []byte(script), 0o755))
+
+	return dir
+}
+
+func TestFind(t *testing.T) {
+	dir := writePlugin(t, "test")
+
+	path, ok := Find("test", []string{dir})
+	require.True(t, ok)
+	require.Equal(t, filepath.Join(dir, "vals-provider-test"), path)
+
+	_, ok = Find("other", []string{dir})
+	require.False(t, ok)
+
+	_, ok = Find("../test", []string{dir})
+	require.False(t, ok)
+}
+
+func TestClient(t *testing.T) {
+	dir := writePlugin(t, "test")
+
+	path, ok := Find("test", []string{dir})
+	require.True(t, ok)
+
+	c, err := Start("test", path, Permissions{}, nil)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, c.Close()) }()
+
+	meta := c.Describe()
+	require.Equal(t, "test", meta.Scheme)
+	require.Equal(t, "Test plugin", meta.Description)
+	require.True(t, meta.Capabilities.StringMap)
+
+	p := c.Provider(map[string]string{"suffix": "x"})
+
+	s, err := p.GetString("foo/bar")
+	require.NoError(t, err)
+	require.Equal(t, "foo/bar-x", s)
+
+	m, err := p.GetStringMap("foo")
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"path": "foo"}, m)
+
+	_, err = p.GetString("missing")
+	require.EqualError(t, err, `plugin for "test": getString: not found (code 1)`)
+}
+
+func TestStart_ProtocolVersionMismatch(t *testing.T) {
+	dir := writePlugin(t, "test", "VALS_TEST_HELPER_PLUGIN_VERSION=2")
+
+	_, err := Start("test", filepath.Join(dir, "vals-provider-test"), Permissions{}, nil)
+	require.ErrorContains(t, err, "speaks protocol version 2, but vals speaks 1")
+}
+
+func TestClient_CloseKillsHangingPlugin(t *testing.T) {
+	dir := writePlugin(t, "test", "VALS_TEST_HELPER_PLUGIN_HANG=1")
+
+	c, err := Start("test", filepath.Join(dir, "vals-provider-test"), Permissions{}, nil)
+	require.NoError(t, err)
+
+	timeout := CloseTimeout
+	CloseTimeout = 100 * time.Millisecond
+	defer func() { CloseTimeout = timeout }()
+
+	start := time.Now()
+	err = c.Close()
+	require.EqualError(t, err, `plugin for "test": killed after not exiting within 100ms of its stdin being closed`)
+	require.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestClient_CallTimeout(t *testing.T) {
+	dir := writePlugin(t, "test")
+
+	logs := &bytes.Buffer{}
+	c, err := Start("test", filepath.Join(dir, "vals-provider-test"), Permissions{}, logs)
+	require.NoError(t, err)
+
+	s, err := c.Provider(nil).GetString("log")
+	require.NoError(t, err)
+	require.Equal(t, "logged", s)
+
+	timeout := CallTimeout
+	CallTimeout = 100 * time.Millisecond
+	defer func() { CallTimeout = timeout }()
+
+	_, err = c.Provider(nil).GetString("hang")
+	require.EqualError(t, err, `plugin for "test": getString: killed after not responding within 100ms`)
+
+	_, err = c.Provider(nil).GetString("foo")
+	require.EqualError(t, err, `plugin for "test": getString: killed after not responding in time`)
+
+	require.NoError(t, c.Close())
+	require.Equal(t, "log from the plugin\n", logs.String())
+}
@@ -0,0 +1,121 @@
+//go:build wasip1
+
+// This is a WebAssembly plugin used by wasm_test.go, built with:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o vals-provider-test.wasm ./testdata/wasm
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"unsafe"
+)
+
+//go:wasmimport vals env_get
+func envGet(ptr unsafe.Pointer, size uint32) int32
+
+//go:wasmimport vals http_request
+func httpRequest(ptr unsafe.Pointer, size uint32) int32
+
+//go:wasmimport vals result_read
+func resultRead(ptr unsafe.Pointer)
+
+// buffers keeps the memory handed out to vals alive until it is freed.
+var buffers = map[uint32][]byte{}
+
+//go:wasmexport vals_alloc
+func alloc(size uint32) uint32 {
+	b := make([]byte, size+1)
+	ptr := uint32(uintptr(unsafe.Pointer(&b[0])))
+	buffers[ptr] = b
+	return ptr
+}
+
+//go:wasmexport vals_free
+func free(ptr uint32) {
+	delete(buffers, ptr)
+}
+
+//go:wasmexport vals_call
+func call(ptr, size uint32) uint64 {
+	var req struct {
+		ID     int    `json:"id"`
+		Method string `json:"method"`
+		Params struct {
+			Path   string            `json:"path"`
+			Params map[string]string `json:"params"`
+		} `json:"params"`
+	}
+
+	res := map[string]interface{}{"jsonrpc": "2.0"}
+	if err := json.Unmarshal(buffers[ptr][:size], &req); err != nil {
+		res["error"] = map[string]interface{}{"code": -32700, "message": err.Error()}
+	} else {
+		res["id"] = req.ID
+		result, err := handle(req.Method, req.Params.Path, req.Params.Params)
+		if err != "" {
+			res["error"] = map[string]interface{}{"code": 1, "message": err}
+		} else {
+			res["result"] = result
+		}
+	}
+
+	out, _ := json.Marshal(res)
+	outPtr := alloc(uint32(len(out)))
+	copy(buffers[outPtr], out)
+	return uint64(outPtr)<<32 | uint64(len(out))
+}
+
+func handle(method, path string, params map[string]string) (interface{}, string) {
+	switch method {
+	case "describe":
+		return map[string]interface{}{
+			"protocolVersion": 1,
+			"metadata":        map[string]interface{}{"description": "Test WebAssembly plugin"},
+		}, ""
+	case "getString":
+		switch path {
+		case "env":
+			return getResult(envGet, params["name"])
+		case "http":
+			req, _ := json.Marshal(map[string]string{"url": params["url"]})
+			s, errMsg := getResult(httpRequest, string(req))
+			if errMsg != "" {
+				return nil, errMsg
+			}
+			var res struct {
+				Body  string `json:"body"`
+				Error string `json:"error"`
+			}
+			_ = json.Unmarshal([]byte(s), &res)
+			if res.Error != "" {
+				return nil, res.Error
+			}
+			return res.Body, ""
+		case "loop":
+			for {
+			}
+		case "file":
+			bs, err := os.ReadFile(params["name"])
+			if err != nil {
+				return nil, err.Error()
+			}
+			return string(bs), ""
+		}
+		return nil, "unknown path " + path
+	}
+	return nil, "unsupported method " + method
+}
+
+func getResult(f func(unsafe.Pointer, uint32) int32, arg string) (string, string) {
+	in := []byte(arg + "\x00")
+	n := f(unsafe.Pointer(&in[0]), uint32(len(arg)))
+	if n < 0 {
+		return "", "not available"
+	}
+	out := make([]byte, n+1)
+	resultRead(unsafe.Pointer(&out[0]))
+	return string(out[:n]), ""
+}
+
+func main() {}
@@ -0,0 +1,356 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	wasmapi "github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// WasmExtension is appended to the name of WebAssembly plugins, like vals-provider-<scheme>.wasm.
+const WasmExtension = ".wasm"
+
+// HostModule is the name of the module whose functions are imported by WebAssembly plugins.
+//
+// WebAssembly plugins must export:
+//
+//   - vals_alloc(size i32) -> i32, returning a pointer to size bytes of the plugin memory,
+//   - vals_call(ptr i32, len i32) -> i64, handling the request at ptr and returning its response
+//     as the pointer in the upper 32 bits and the length in the lower ones,
+//
+// and optionally vals_free(ptr i32), called with each request and response once they are no longer used.
+// They can import from this module:
+//
+//   - env_get(name_ptr i32, name_len i32) -> i32, fetching an allowed environment variable,
+//   - http_request(req_ptr i32, req_len i32) -> i32, sending a request
+//     {"method": "GET", "url": "...", "headers": {...}, "body": "..."} to an allowed host,
+//     and getting back {"status": 200, "headers": {...}, "body": "...", "error": "..."},
+//   - result_read(ptr i32), copying the result of the last env_get or http_request to ptr,
+//   - log(ptr i32, len i32), writing a message to the log output of vals.
+//
+// env_get and http_request return the length of their result, or -1 when there is none.
+// WASI is available, without any access to the filesystem, environment variables or arguments.
+const HostModule = "vals"
+
+// Permissions are the capabilities granted to a WebAssembly plugin.
+// Plugins cannot read files or run commands, whatever their permissions.
+type Permissions struct {
+	// Hosts lists the hosts the plugin can send HTTP requests to.
+	// "*.example.com" allows any subdomain of example.com.
+	Hosts []string `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	// Env lists the environment variables the plugin can read.
+	Env []string `json:"env,omitempty" yaml:"env,omitempty"`
+}
+
+var nonAlnumRegexp = regexp.MustCompile(`[^A-Z0-9]`)
+
+// PermissionsFromEnv returns the permissions granted to the plugin for the scheme
+// by the comma-separated VALS_PLUGIN_<SCHEME>_ALLOW_HOSTS and VALS_PLUGIN_<SCHEME>_ALLOW_ENV environment variables.
+func PermissionsFromEnv(scheme string) Permissions {
+	prefix := "VALS_PLUGIN_" + nonAlnumRegexp.ReplaceAllString(strings.ToUpper(scheme), "_") + "_ALLOW_"
+	return Permissions{
+		Hosts: splitList(os.Getenv(prefix + "HOSTS")),
+		Env:   splitList(os.Getenv(prefix + "ENV")),
+	}
+}
+
+func splitList(s string) []string {
+	var res []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// AllowsHost reports whether the plugin can send HTTP requests to the host.
+func (p Permissions) AllowsHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, h := range p.Hosts {
+		h = strings.ToLower(h)
+		if h == host || strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsEnv reports whether the plugin can read the environment variable.
+func (p Permissions) AllowsEnv(name string) bool {
+	for _, e := range p.Env {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
+
+type httpRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+type httpResponse struct {
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// wasm runs a WebAssembly plugin in its own runtime, so that nothing is shared between plugins.
+type wasm struct {
+	ctx     context.Context
+	runtime wazero.Runtime
+	mod     wasmapi.Module
+	alloc   wasmapi.Function
+	call    wasmapi.Function
+	free    wasmapi.Function
+
+	perms  Permissions
+	client *http.Client
+	logOut io.Writer
+	// result is the result of the last env_get or http_request call, to be copied by result_read.
+	result []byte
+}
+
+func startWasm(scheme, path string, perms Permissions, logOut io.Writer) (*wasm, error) {
+	bin, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading plugin %s: %w", path, err)
+	}
+
+	ctx := context.Background()
+
+	w := &wasm{
+		ctx:     ctx,
+		runtime: wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true)),
+		perms:   perms,
+		logOut:  logOut,
+	}
+	w.client = &http.Client{
+		Timeout: 30 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !w.perms.AllowsHost(req.URL.Hostname()) {
+				return fmt.Errorf("plugin for %q is not allowed to access host %q", scheme, req.URL.Hostname())
+			}
+			return nil
+		},
+	}
+
+	if err := w.instantiate(bin); err != nil {
+		_ = w.close()
+		return nil, fmt.Errorf("loading plugin %s: %w", path, err)
+	}
+
+	return w, nil
+}
+
+func (w *wasm) instantiate(bin []byte) error {
+	if _, err := wasi_snapshot_preview1.Instantiate(w.ctx, w.runtime); err != nil {
+		return err
+	}
+
+	_, err := w.runtime.NewHostModuleBuilder(HostModule).
+		NewFunctionBuilder().WithFunc(w.envGet).Export("env_get").
+		NewFunctionBuilder().WithFunc(w.httpRequest).Export("http_request").
+		NewFunctionBuilder().WithFunc(w.resultRead).Export("result_read").
+		NewFunctionBuilder().WithFunc(w.log).Export("log").
+		Instantiate(w.ctx)
+	if err != nil {
+		return err
+	}
+
+	compiled, err := w.runtime.CompileModule(w.ctx, bin)
+	if err != nil {
+		return err
+	}
+
+	// The default module config grants no access to the filesystem, environment variables or arguments.
+	conf := wazero.NewModuleConfig().
+		WithName("").
+		WithStderr(w.logOut).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader).
+		WithStartFunctions("_initialize")
+
+	w.mod, err = w.runtime.InstantiateModule(w.ctx, compiled, conf)
+	if err != nil {
+		return err
+	}
+
+	w.alloc = w.mod.ExportedFunction("vals_alloc")
+	w.call = w.mod.ExportedFunction("vals_call")
+	w.free = w.mod.ExportedFunction("vals_free")
+	if w.alloc == nil || w.call == nil {
+		return errors.New("the module must export vals_alloc and vals_call")
+	}
+
+	return nil
+}
+
+func (w *wasm) roundTrip(req []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(w.ctx, CallTimeout)
+	defer cancel()
+
+	out, err := w.roundTripContext(ctx, req)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("stopped after running for longer than %s", CallTimeout)
+	}
+	return out, err
+}
+
+func (w *wasm) roundTripContext(ctx context.Context, req []byte) ([]byte, error) {
+	res, err := w.alloc.Call(ctx, uint64(len(req)))
+	if err != nil {
+		return nil, err
+	}
+	reqPtr := uint32(res[0])
+
+	if !w.mod.Memory().Write(reqPtr, req) {
+		return nil, errors.New("vals_alloc returned memory out of range")
+	}
+
+	res, err = w.call.Call(ctx, uint64(reqPtr), uint64(len(req)))
+	if err != nil {
+		return nil, err
+	}
+	resPtr, resLen := uint32(res[0]>>32), uint32(res[0])
+
+	view, ok := w.mod.Memory().Read(resPtr, resLen)
+	if !ok {
+		return nil, errors.New("vals_call returned memory out of range")
+	}
+	out := bytes.Clone(view)
+
+	if w.free != nil {
+		if _, err := w.free.Call(ctx, uint64(reqPtr)); err != nil {
+			return nil, err
+		}
+		if _, err := w.free.Call(ctx, uint64(resPtr)); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+func (w *wasm) close() error {
+	return w.runtime.Close(w.ctx)
+}
+
+func (w *wasm) read(m wasmapi.Module, ptr, size uint32) string {
+	bs, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		panic(fmt.Errorf("memory access out of range: %d+%d", ptr, size))
+	}
+	return string(bs)
+}
+
+func (w *wasm) setResult(bs []byte) int32 {
+	w.result = bs
+	return int32(len(bs))
+}
+
+func (w *wasm) envGet(_ context.Context, m wasmapi.Module, namePtr, nameLen uint32) int32 {
+	w.result = nil
+
+	name := w.read(m, namePtr, nameLen)
+	if !w.perms.AllowsEnv(name) {
+		return -1
+	}
+
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return -1
+	}
+	return w.setResult([]byte(v))
+}
+
+func (w *wasm) httpRequest(ctx context.Context, m wasmapi.Module, reqPtr, reqLen uint32) int32 {
+	w.result = nil
+
+	res := w.doHTTPRequest(ctx, w.read(m, reqPtr, reqLen))
+
+	bs, err := json.Marshal(res)
+	if err != nil {
+		panic(err)
+	}
+	return w.setResult(bs)
+}
+
+func (w *wasm) doHTTPRequest(ctx context.Context, reqJSON string) httpResponse {
+	var r httpRequest
+	if err := json.Unmarshal([]byte(reqJSON), &r); err != nil {
+		return httpResponse{Error: fmt.Sprintf("malformed request: %v", err)}
+	}
+
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return httpResponse{Error: fmt.Sprintf("malformed url: %v", err)}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return httpResponse{Error: fmt.Sprintf("unsupported url scheme %q", u.Scheme)}
+	}
+	if !w.perms.AllowsHost(u.Hostname()) {
+		return httpResponse{Error: fmt.Sprintf("host %q is not allowed", u.Hostname())}
+	}
+
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), strings.NewReader(r.Body))
+	if err != nil {
+		return httpResponse{Error: err.Error()}
+	}
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return httpResponse{Error: err.Error()}
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return httpResponse{Error: err.Error()}
+	}
+
+	headers := map[string]string{}
+	for k := range resp.Header {
+		headers[k] = resp.Header.Get(k)
+	}
+
+	return httpResponse{Status: resp.StatusCode, Headers: headers, Body: string(body)}
+}
+
+func (w *wasm) resultRead(_ context.Context, m wasmapi.Module, ptr uint32) {
+	if !m.Memory().Write(ptr, w.result) {
+		panic(fmt.Errorf("memory access out of range: %d+%d", ptr, len(w.result)))
+	}
+	w.result = nil
+}
+
+func (w *wasm) log(_ context.Context, m wasmapi.Module, ptr, size uint32) {
+	_, _ = fmt.Fprintln(w.logOut, w.read(m, ptr, size))
+}
@@ -0,0 +1,111 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// buildWasmPlugin builds testdata/wasm into vals-provider-<scheme>.wasm in a temporary directory.
+func buildWasmPlugin(t *testing.T, scheme string) string {
+	t.Helper()
+
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is required to build the WebAssembly plugin")
+	}
+
+	path := filepath.Join(t.TempDir(), ExecutablePrefix+scheme+WasmExtension)
+
+	cmd := exec.Command(goBin, "build", "-buildmode=c-shared", "-o", path, "./testdata/wasm")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	return path
+}
+
+func TestWasm(t *testing.T) {
+	path := buildWasmPlugin(t, "test")
+
+	found, ok := Find("test", []string{filepath.Dir(path)})
+	require.True(t, ok)
+	require.Equal(t, path, found)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "hello from %s", r.URL.Path)
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	t.Setenv("VALS_TEST_ALLOWED", "allowed")
+	t.Setenv("VALS_TEST_DENIED", "denied")
+
+	c, err := Start("test", path, Permissions{
+		Hosts: []string{u.Hostname()},
+		Env:   []string{"VALS_TEST_ALLOWED"},
+	}, nil)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, c.Close()) }()
+
+	require.Equal(t, "Test WebAssembly plugin", c.Describe().Description)
+
+	get := func(path string, params map[string]string) (string, error) {
+		return c.Provider(params).GetString(path)
+	}
+
+	s, err := get("env", map[string]string{"name": "VALS_TEST_ALLOWED"})
+	require.NoError(t, err)
+	require.Equal(t, "allowed", s)
+
+	_, err = get("env", map[string]string{"name": "VALS_TEST_DENIED"})
+	require.EqualError(t, err, `plugin for "test": getString: not available (code 1)`)
+
+	s, err = get("http", map[string]string{"url": srv.URL + "/foo"})
+	require.NoError(t, err)
+	require.Equal(t, "hello from /foo", s)
+
+	_, err = get("http", map[string]string{"url": "http://example.com/"})
+	require.EqualError(t, err, `plugin for "test": getString: host "example.com" is not allowed (code 1)`)
+
+	_, err = get("file", map[string]string{"name": path})
+	require.ErrorContains(t, err, `plugin for "test": getString: open `)
+}
+
+func TestWasm_CallTimeout(t *testing.T) {
+	path := buildWasmPlugin(t, "test")
+
+	c, err := Start("test", path, Permissions{}, nil)
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+
+	timeout := CallTimeout
+	CallTimeout = 100 * time.Millisecond
+	defer func() { CallTimeout = timeout }()
+
+	_, err = c.Provider(nil).GetString("loop")
+	require.EqualError(t, err, `plugin for "test": getString: stopped after running for longer than 100ms`)
+}
+
+func TestPermissions(t *testing.T) {
+	p := Permissions{Hosts: []string{"vault.example.com", "*.corp.example"}}
+
+	require.True(t, p.AllowsHost("vault.example.com"))
+	require.True(t, p.AllowsHost("secrets.corp.example"))
+	require.False(t, p.AllowsHost("corp.example"))
+	require.False(t, p.AllowsHost("example.com"))
+
+	t.Setenv("VALS_PLUGIN_MY_CORP_ALLOW_HOSTS", "a.example, b.example")
+	t.Setenv("VALS_PLUGIN_MY_CORP_ALLOW_ENV", "TOKEN")
+	require.Equal(t, Permissions{Hosts: []string{"a.example", "b.example"}, Env: []string{"TOKEN"}}, PermissionsFromEnv("my-corp"))
+}
@@ -1,6 +1,9 @@
 package registry
 
 import (
+	"sort"
+	"strings"
+
 	"github.com/helmfile/vals/pkg/api"
 	"github.com/helmfile/vals/pkg/config"
 	"github.com/helmfile/vals/pkg/log"
@@ -15,14 +18,100 @@ type StringProviderFactory func(l *log.Logger, provider api.StaticConfig, awsLog
 // StringMapProviderFactory creates a string-map provider for use in stringmapprovider.New.
 type StringMapProviderFactory func(l *log.Logger, provider api.StaticConfig, awsLogLevel string) (api.LazyLoadedStringMapProvider, error)
 
+// Param describes a query parameter understood by a provider.
+type Param struct {
+	Name string `json:"name"`
+	// Type is one of "string", "bool", "int", "enum" or "flag".
+	// A "flag" is enabled by its presence, like ?inCluster, whatever its value.
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	// Values lists the accepted values of an "enum" parameter.
+	Values  []string `json:"values,omitempty"`
+	Default string   `json:"default,omitempty"`
+	// Required parameters must be set either in the ref or via an environment variable.
+	Required bool `json:"required,omitempty"`
+	// Sensitive parameters carry credentials, and should not be logged or displayed.
+	Sensitive bool `json:"sensitive,omitempty"`
+	// Prefix marks Name as a prefix of parameter names, like exec's env_<NAME>.
+	Prefix bool `json:"prefix,omitempty"`
+	// Env lists the environment variables that the provider falls back to when the parameter is omitted,
+	// in addition to VALS_<NAME>.
+	Env []string `json:"env,omitempty"`
+}
+
+// Capabilities describes the optional features of a provider.
+type Capabilities struct {
+	// StringMap is set when GetStringMap is supported, i.e. the provider returns documents
+	// that can be used with refMap.
+	StringMap bool `json:"stringMap"`
+	// Fragment is set when #/path/to/key fragments are supported.
+	Fragment bool `json:"fragment"`
+}
+
+// Metadata describes a provider for documentation, linting and completion.
+type Metadata struct {
+	Scheme      string `json:"scheme"`
+	Description string `json:"description"`
+	// BuildTag is the build tag that includes the provider in custom builds.
+	// It is empty for the providers that are always available.
+	BuildTag     string       `json:"buildTag,omitempty"`
+	Params       []Param      `json:"params,omitempty"`
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+// Param returns the parameter with the given name, including prefixed ones.
+func (m Metadata) Param(name string) (Param, bool) {
+	for _, p := range m.Params {
+		if p.Name == name || p.Prefix && strings.HasPrefix(name, p.Name) {
+			return p, true
+		}
+	}
+	return Param{}, false
+}
+
 var (
 	providers          = map[string]ProviderFactory{}
+	metadata           = map[string]Metadata{}
 	stringProviders    = map[string]StringProviderFactory{}
 	stringMapProviders = map[string]StringMapProviderFactory{}
 )
 
-func RegisterProvider(scheme string, f ProviderFactory) {
+// RegisterProvider registers the factory of the provider for the scheme,
+// along with an optional description of the provider.
+func RegisterProvider(scheme string, f ProviderFactory, meta ...Metadata) {
 	providers[scheme] = f
+
+	if len(meta) > 0 {
+		m := meta[0]
+		m.Scheme = scheme
+		metadata[scheme] = m
+	} else {
+		delete(metadata, scheme)
+	}
+}
+
+// Describe returns the metadata of the provider registered for the scheme.
+// It returns false when the provider is not registered or was registered without metadata.
+func Describe(scheme string) (Metadata, bool) {
+	m, ok := metadata[scheme]
+	return m, ok
+}
+
+// Providers returns the metadata of all the registered providers, sorted by scheme.
+// Providers registered without metadata are described by their scheme only.
+func Providers() []Metadata {
+	res := make([]Metadata, 0, len(providers))
+	for scheme := range providers {
+		m, ok := metadata[scheme]
+		if !ok {
+			m = Metadata{Scheme: scheme}
+		}
+		res = append(res, m)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Scheme < res[j].Scheme
+	})
+	return res
 }
 
 func GetProvider(scheme string) (ProviderFactory, bool) {
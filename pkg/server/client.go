@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/helmfile/vals"
+)
+
+// Client delegates evaluation to a server. Its methods mirror the functions of the vals package,
+// so that callers can switch between them transparently.
+// Only the ExcludeSecret, FailOnMissingKeyInMap, Recursive and RecursionDepth options are sent to the server,
+// which applies its own options otherwise.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient returns a client for the server at addr, which is either unix:///path/to/socket or https://host:port.
+// tlsConfig is required for https.
+func NewClient(addr string, tlsConfig *tls.Config) (*Client, error) {
+	network, address, err := ParseAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{}
+
+	c := &Client{http: &http.Client{Transport: transport}}
+
+	switch network {
+	case "unix":
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", address)
+		}
+		c.baseURL = "http://vals"
+	default:
+		if tlsConfig == nil {
+			return nil, errors.New("connecting over https requires a TLS config")
+		}
+		transport.TLSClientConfig = tlsConfig
+		c.baseURL = "https://" + address
+	}
+
+	return c, nil
+}
+
+// ClientTLSConfig returns a TLS config presenting the client certificate,
+// and trusting the servers whose certificates are signed by one of the CAs in caFile.
+func ClientTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := loadCertPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func requestOptions(opts vals.Options) Options {
+	return Options{
+		ExcludeSecret:         opts.ExcludeSecret,
+		FailOnMissingKeyInMap: opts.FailOnMissingKeyInMap,
+		Recursive:             opts.Recursive,
+		RecursionDepth:        opts.RecursionDepth,
+	}
+}
+
+// Get is like vals.Get.
+func (c *Client) Get(code string, opts vals.Options) (string, error) {
+	res, err := c.post("/v1/get", stringRequest{Code: code, Options: requestOptions(opts)})
+	if err != nil {
+		return "", err
+	}
+	return res.Result, nil
+}
+
+// Flatten is like vals.Flatten.
+func (c *Client) Flatten(code string, escape string, opts vals.Options) (string, error) {
+	res, err := c.post("/v1/flatten", stringRequest{Code: code, Escape: escape, Options: requestOptions(opts)})
+	if err != nil {
+		return "", err
+	}
+	return res.Result, nil
+}
+
+// EvalNodes is like vals.EvalNodes.
+func (c *Client) EvalNodes(nodes []yaml.Node, opts vals.Options) ([]yaml.Node, error) {
+	in, err := encodeYAML(nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.post("/v1/eval", evalRequest{YAML: in, Options: requestOptions(opts)})
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeYAML(res.YAML)
+}
+
+// Eval is like vals.Eval.
+func (c *Client) Eval(template map[string]interface{}, opts vals.Options) (map[string]interface{}, error) {
+	var node yaml.Node
+	if err := node.Encode(template); err != nil {
+		return nil, err
+	}
+
+	nodes, err := c.EvalNodes([]yaml.Node{{Kind: yaml.DocumentNode, Content: []*yaml.Node{&node}}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) != 1 {
+		return nil, fmt.Errorf("vals server: expected a single document, got %d", len(nodes))
+	}
+
+	res := map[string]interface{}{}
+	if err := nodes[0].Decode(&res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Flush drops the values cached by the server, so that they are fetched again.
+func (c *Client) Flush() error {
+	_, err := c.post("/v1/flush", struct{}{})
+	return err
+}
+
+func (c *Client) post(path string, req interface{}) (*response, error) {
+	bs, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Post(c.baseURL+path, "application/json", bytes.NewReader(bs))
+	if err != nil {
+		return nil, fmt.Errorf("vals server: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var res response
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("vals server: malformed response with status %s: %w", resp.Status, err)
+	}
+	if res.Error != "" {
+		return nil, errors.New(res.Error)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vals server: unexpected status %s", resp.Status)
+	}
+
+	return &res, nil
+}
@@ -0,0 +1,445 @@
+// Package server serves vals over HTTP, on a unix socket or over mutually authenticated TLS,
+// so that short-lived processes can share the provider clients and caches of a long-lived Runtime.
+//
+// The endpoints accept and return JSON:
+//
+//   - POST /v1/get: {"code": "...", "options": {...}} -> {"result": "..."}, like vals.Get
+//   - POST /v1/flatten: {"code": "...", "escape": "json", "options": {...}} -> {"result": "..."}, like vals.Flatten
+//   - POST /v1/eval: {"yaml": "...", "options": {...}} -> {"yaml": "..."}, like vals.EvalNodes over a YAML stream
+//   - POST /v1/flush: {} -> {"status": "ok"}, dropping the cached values so that they are fetched again
+//   - GET /healthz: {"status": "ok"}
+//
+// Errors are returned as {"error": "..."}. Request bodies are limited to 64 MiB.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/helmfile/vals"
+)
+
+// Options are the per-request options, that are applied on top of the options of the server.
+type Options struct {
+	ExcludeSecret         bool `json:"excludeSecret,omitempty"`
+	FailOnMissingKeyInMap bool `json:"failOnMissingKeyInMap,omitempty"`
+	Recursive             bool `json:"recursive,omitempty"`
+	RecursionDepth        int  `json:"recursionDepth,omitempty"`
+}
+
+type stringRequest struct {
+	Code    string  `json:"code"`
+	Escape  string  `json:"escape,omitempty"`
+	Options Options `json:"options"`
+}
+
+type evalRequest struct {
+	YAML    string  `json:"yaml"`
+	Options Options `json:"options"`
+}
+
+type response struct {
+	Result string `json:"result,omitempty"`
+	YAML   string `json:"yaml,omitempty"`
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Server resolves refs with long-lived runtimes, one per combination of Options,
+// so that provider clients, sessions and caches are reused across requests.
+// Requests with the same Options are evaluated one at a time, as providers are not safe for concurrent use,
+// while those with different ones run concurrently.
+type Server struct {
+	// CacheTTL is how long a runtime, along with the values it cached, is used before being replaced by a new one,
+	// so that secrets rotated in the backends are picked up. Zero keeps the runtimes until they are flushed.
+	CacheTTL time.Duration
+
+	opts vals.Options
+
+	m        sync.Mutex
+	runtimes map[Options]*serverRuntime
+}
+
+type serverRuntime struct {
+	*vals.Runtime
+	created time.Time
+
+	// m is held while the runtime is used, as providers are not safe for concurrent use.
+	m      sync.Mutex
+	closed bool
+}
+
+// close stops the runtime once the request using it, if any, is done.
+func (r *serverRuntime) close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.closed = true
+	return r.Runtime.Close()
+}
+
+// New returns a server creating its runtimes with opts.
+func New(opts vals.Options) *Server {
+	return &Server{
+		opts:     opts,
+		runtimes: map[Options]*serverRuntime{},
+	}
+}
+
+// Handler returns the HTTP handler serving the endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/get", s.handleGet)
+	mux.HandleFunc("POST /v1/flatten", s.handleFlatten)
+	mux.HandleFunc("POST /v1/eval", s.handleEval)
+	mux.HandleFunc("POST /v1/flush", s.handleFlush)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		writeResponse(w, http.StatusOK, response{Status: "ok"})
+	})
+	return mux
+}
+
+// Close stops the runtimes of the server, along with the plugins they started.
+// The server can still be used afterwards, with new runtimes fetching the values again.
+func (s *Server) Close() error {
+	s.m.Lock()
+	runtimes := s.runtimes
+	s.runtimes = map[Options]*serverRuntime{}
+	s.m.Unlock()
+
+	var errs []error
+	for _, r := range runtimes {
+		errs = append(errs, r.close())
+	}
+	return errors.Join(errs...)
+}
+
+// ListenAndServe serves on addr, which is either unix:///path/to/socket or https://host:port,
+// until ctx is done. tlsConfig is required for https.
+func (s *Server) ListenAndServe(ctx context.Context, addr string, tlsConfig *tls.Config) error {
+	network, address, err := ParseAddress(addr)
+	if err != nil {
+		return err
+	}
+
+	var l net.Listener
+	switch network {
+	case "unix":
+		l, err = listenUnix(address)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = os.Remove(address) }()
+	default:
+		if tlsConfig == nil {
+			return errors.New("serving over https requires a TLS config")
+		}
+		l, err = tls.Listen("tcp", address, tlsConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(l)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+// listenUnix listens on the socket at path, readable and writable only by the current user.
+// A socket left over by a previous server is removed, but not one that a running server listens on.
+func listenUnix(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("%s is already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// The socket is created in a directory that only the user can access, and only moved into place
+	// once it is restricted to the user, so that nobody else can connect in between.
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".vals-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	tmp := filepath.Join(dir, "s")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// The socket is removed by ListenAndServe, at its final path.
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if err := os.Chmod(tmp, 0o600); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// ParseAddress returns the network and address denoted by unix:///path/to/socket or https://host:port.
+func ParseAddress(addr string) (network, address string, err error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch u.Scheme {
+	case "unix":
+		if u.Host != "" || u.Path == "" {
+			return "", "", fmt.Errorf("invalid address %q: expected unix:///path/to/socket", addr)
+		}
+		return "unix", u.Path, nil
+	case "https":
+		if u.Host == "" {
+			return "", "", fmt.Errorf("invalid address %q: expected https://host:port", addr)
+		}
+		return "tcp", u.Host, nil
+	default:
+		return "", "", fmt.Errorf("unsupported address %q: expected unix:///path/to/socket or https://host:port", addr)
+	}
+}
+
+// ServerTLSConfig returns a TLS config serving the certificate, and requiring clients
+// to present a certificate signed by one of the CAs in clientCAFile.
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := loadCertPool(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", file)
+	}
+	return pool, nil
+}
+
+// runtime returns the runtime for the per-request options, creating it on first use,
+// along with the runtime it replaced once expired, which is to be closed.
+// It must be called with s.m held.
+func (s *Server) runtime(o Options) (*serverRuntime, *serverRuntime, error) {
+	var expired *serverRuntime
+	if r, ok := s.runtimes[o]; ok {
+		if s.CacheTTL <= 0 || time.Since(r.created) < s.CacheTTL {
+			return r, nil, nil
+		}
+		expired = r
+		delete(s.runtimes, o)
+	}
+
+	opts := s.opts
+	opts.ExcludeSecret = o.ExcludeSecret
+	opts.FailOnMissingKeyInMap = o.FailOnMissingKeyInMap
+	opts.Recursive = o.Recursive
+	opts.RecursionDepth = o.RecursionDepth
+
+	r, err := vals.New(opts)
+	if err != nil {
+		return nil, expired, err
+	}
+
+	sr := &serverRuntime{Runtime: r, created: time.Now()}
+	s.runtimes[o] = sr
+	return sr, expired, nil
+}
+
+// do runs f with the runtime for the per-request options.
+func (s *Server) do(o Options, f func(r *vals.Runtime) (response, error)) (response, error) {
+	for {
+		s.m.Lock()
+		r, expired, err := s.runtime(o)
+		s.m.Unlock()
+
+		if expired != nil {
+			_ = expired.close()
+		}
+		if err != nil {
+			return response{}, err
+		}
+
+		r.m.Lock()
+		// The runtime was closed by a flush or replaced after expiring while waiting for it.
+		if r.closed {
+			r.m.Unlock()
+			continue
+		}
+		res, err := f(r.Runtime)
+		r.m.Unlock()
+		return res, err
+	}
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, req *http.Request) {
+	var in stringRequest
+	if !readRequest(w, req, &in) {
+		return
+	}
+
+	res, err := s.do(in.Options, func(r *vals.Runtime) (response, error) {
+		v, err := r.Get(in.Code)
+		return response{Result: v}, err
+	})
+	writeResult(w, res, err)
+}
+
+func (s *Server) handleFlatten(w http.ResponseWriter, req *http.Request) {
+	var in stringRequest
+	if !readRequest(w, req, &in) {
+		return
+	}
+
+	res, err := s.do(in.Options, func(r *vals.Runtime) (response, error) {
+		v, err := r.Flatten(in.Code, in.Escape)
+		return response{Result: v}, err
+	})
+	writeResult(w, res, err)
+}
+
+func (s *Server) handleEval(w http.ResponseWriter, req *http.Request) {
+	var in evalRequest
+	if !readRequest(w, req, &in) {
+		return
+	}
+
+	nodes, err := decodeYAML(in.YAML)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, response{Error: err.Error()})
+		return
+	}
+
+	res, err := s.do(in.Options, func(r *vals.Runtime) (response, error) {
+		nodes, err := r.EvalNodes(nodes)
+		if err != nil {
+			return response{}, err
+		}
+		out, err := encodeYAML(nodes)
+		return response{YAML: out}, err
+	})
+	writeResult(w, res, err)
+}
+
+func (s *Server) handleFlush(w http.ResponseWriter, _ *http.Request) {
+	if err := s.Close(); err != nil {
+		writeResponse(w, http.StatusInternalServerError, response{Error: err.Error()})
+		return
+	}
+	writeResponse(w, http.StatusOK, response{Status: "ok"})
+}
+
+// maxRequestSize limits the size of request bodies, so that clients cannot exhaust the memory of the server.
+var maxRequestSize int64 = 64 << 20
+
+func readRequest(w http.ResponseWriter, req *http.Request, v interface{}) bool {
+	body := http.MaxBytesReader(w, req.Body, maxRequestSize)
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeResponse(w, http.StatusRequestEntityTooLarge, response{Error: fmt.Sprintf("request larger than %d bytes", tooLarge.Limit)})
+			return false
+		}
+		writeResponse(w, http.StatusBadRequest, response{Error: fmt.Sprintf("malformed request: %v", err)})
+		return false
+	}
+	return true
+}
+
+func writeResult(w http.ResponseWriter, res response, err error) {
+	if err != nil {
+		writeResponse(w, http.StatusUnprocessableEntity, response{Error: err.Error()})
+		return
+	}
+	writeResponse(w, http.StatusOK, res)
+}
+
+func writeResponse(w http.ResponseWriter, status int, res response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func decodeYAML(s string) ([]yaml.Node, error) {
+	var nodes []yaml.Node
+	dec := yaml.NewDecoder(strings.NewReader(s))
+	for {
+		var node yaml.Node
+		if err := dec.Decode(&node); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nodes, nil
+			}
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+}
+
+func encodeYAML(nodes []yaml.Node) (string, error) {
+	var buf strings.Builder
+	enc := yaml.NewEncoder(&buf)
+	for i := range nodes {
+		if err := enc.Encode(&nodes[i]); err != nil {
+			return "", err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
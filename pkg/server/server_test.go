@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/helmfile/vals"
+)
+
+// serve runs a server on addr until the test ends.
+func serve(t *testing.T, addr string, s *Server, wait func() error) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.ListenAndServe(ctx, addr, nil)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-errCh)
+		require.NoError(t, s.Close())
+	})
+
+	require.Eventually(t, func() bool { return wait() == nil }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestServer_Unix(t *testing.T) {
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "vals.sock")
+	secret := filepath.Join(dir, "secret.txt")
+	require.NoError(t, os.WriteFile(secret, []byte("v1"), 0o600))
+
+	addr := "unix://" + sock
+	serve(t, addr, New(vals.Options{}), func() error {
+		_, err := os.Stat(sock)
+		return err
+	})
+
+	info, err := os.Stat(sock)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	c, err := NewClient(addr, nil)
+	require.NoError(t, err)
+
+	got, err := c.Get("ref+file://"+secret, vals.Options{})
+	require.NoError(t, err)
+	require.Equal(t, "v1", got)
+
+	// The value is cached by the long-lived runtime of the server.
+	require.NoError(t, os.WriteFile(secret, []byte("v2"), 0o600))
+	got, err = c.Get("ref+file://"+secret, vals.Options{})
+	require.NoError(t, err)
+	require.Equal(t, "v1", got)
+
+	// Flushing drops the cached value.
+	require.NoError(t, c.Flush())
+	got, err = c.Get("ref+file://"+secret, vals.Options{})
+	require.NoError(t, err)
+	require.Equal(t, "v2", got)
+
+	quoted := filepath.Join(dir, "quoted.txt")
+	require.NoError(t, os.WriteFile(quoted, []byte(`x"y`), 0o600))
+	got, err = c.Flatten(`{"a": "ref+file://`+quoted+`+"}`, vals.EscapeJSON, vals.Options{})
+	require.NoError(t, err)
+	require.Equal(t, `{"a": "x\"y"}`, got)
+
+	m, err := c.Eval(map[string]interface{}{"foo": "ref+echo://bar/baz#/bar"}, vals.Options{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"foo": "baz"}, m)
+
+	var nodes []yaml.Node
+	for _, doc := range []string{"b: ref+echo://bb\na: 1\n", "- c: ref+echo://cc\n"} {
+		var n yaml.Node
+		require.NoError(t, yaml.Unmarshal([]byte(doc), &n))
+		nodes = append(nodes, n)
+	}
+	res, err := c.EvalNodes(nodes, vals.Options{})
+	require.NoError(t, err)
+	out, err := encodeYAML(res)
+	require.NoError(t, err)
+	require.Equal(t, "a: 1\nb: bb\n---\n- c: cc\n", out)
+
+	_, err = c.Get("ref+echo://foo/bar#/baz", vals.Options{FailOnMissingKeyInMap: true})
+	require.EqualError(t, err, "expand echo://foo/bar#/baz: no value found for key baz")
+
+	// The socket is created in a temporary directory that is removed once the socket is in place.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.False(t, strings.HasPrefix(e.Name(), ".vals-"), e.Name())
+	}
+
+	// A second server cannot take over the socket of a running one.
+	err = New(vals.Options{}).ListenAndServe(context.Background(), addr, nil)
+	require.EqualError(t, err, sock+" is already in use")
+}
+
+func TestServer_RequestSize(t *testing.T) {
+	size := maxRequestSize
+	maxRequestSize = 1024
+	defer func() { maxRequestSize = size }()
+
+	body := `{"code": "ref+echo://` + strings.Repeat("a", 2048) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/get", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	New(vals.Options{}).Handler().ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	require.JSONEq(t, `{"error": "request larger than 1024 bytes"}`, rec.Body.String())
+}
+
+func TestServer_CacheTTL(t *testing.T) {
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "vals.sock")
+	secret := filepath.Join(dir, "secret.txt")
+	require.NoError(t, os.WriteFile(secret, []byte("v1"), 0o600))
+
+	s := New(vals.Options{})
+	s.CacheTTL = 200 * time.Millisecond
+
+	addr := "unix://" + sock
+	serve(t, addr, s, func() error {
+		_, err := os.Stat(sock)
+		return err
+	})
+
+	c, err := NewClient(addr, nil)
+	require.NoError(t, err)
+
+	got, err := c.Get("ref+file://"+secret, vals.Options{})
+	require.NoError(t, err)
+	require.Equal(t, "v1", got)
+
+	require.NoError(t, os.WriteFile(secret, []byte("v2"), 0o600))
+	require.Eventually(t, func() bool {
+		got, err := c.Get("ref+file://"+secret, vals.Options{})
+		return err == nil && got == "v2"
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestServer_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	caCert, caKey := writeCert(t, dir, "ca", nil, nil)
+	writeCert(t, dir, "server", caCert, caKey)
+	writeCert(t, dir, "client", caCert, caKey)
+	writeCert(t, dir, "other-client", nil, nil)
+
+	f := func(name string) string { return filepath.Join(dir, name) }
+
+	serverTLS, err := ServerTLSConfig(f("server.crt"), f("server.key"), f("ca.crt"))
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := "https://" + l.Addr().String()
+	require.NoError(t, l.Close())
+
+	s := New(vals.Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.ListenAndServe(ctx, addr, serverTLS)
+	}()
+	defer func() {
+		cancel()
+		require.NoError(t, <-errCh)
+	}()
+
+	clientTLS, err := ClientTLSConfig(f("client.crt"), f("client.key"), f("ca.crt"))
+	require.NoError(t, err)
+	c, err := NewClient(addr, clientTLS)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		got, err := c.Get("ref+echo://foo", vals.Options{})
+		return err == nil && got == "foo"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	otherTLS, err := ClientTLSConfig(f("other-client.crt"), f("other-client.key"), f("ca.crt"))
+	require.NoError(t, err)
+	other, err := NewClient(addr, otherTLS)
+	require.NoError(t, err)
+
+	_, err = other.Get("ref+echo://foo", vals.Options{})
+	require.Error(t, err)
+}
+
+// writeCert writes <name>.crt and <name>.key into dir, signed by parent or self-signed.
+func writeCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return cert, key
+}
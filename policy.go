@@ -0,0 +1,200 @@
+package vals
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	execprovider "github.com/helmfile/vals/pkg/providers/exec"
+)
+
+// Policy restricts the refs that vals resolves, so that input which is not fully trusted,
+// like values files from other teams, cannot run arbitrary commands or read arbitrary files.
+//
+// An empty list does not restrict anything: to forbid a provider altogether, deny its scheme.
+type Policy struct {
+	Schemes SchemePolicy `yaml:"schemes,omitempty"`
+	// Exec restricts the commands run by the exec provider.
+	Exec ExecPolicy `yaml:"exec,omitempty"`
+	// File restricts the files read by the file provider.
+	File FilePolicy `yaml:"file,omitempty"`
+	// HTTPJSON restricts the hosts queried by the httpjson provider.
+	HTTPJSON HostPolicy `yaml:"httpjson,omitempty"`
+}
+
+// SchemePolicy restricts the providers that can be used.
+type SchemePolicy struct {
+	// Allow lists the only schemes that can be used.
+	Allow []string `yaml:"allow,omitempty"`
+	// Deny lists schemes that cannot be used, even when allowed.
+	Deny []string `yaml:"deny,omitempty"`
+}
+
+type ExecPolicy struct {
+	// Commands lists the only commands that can be run, exactly as they are written in refs,
+	// like "sops" or "/usr/local/bin/pass".
+	// When set, the env_<NAME> and args parameters are rejected unless allowed by Env and Args,
+	// as they would let refs change what the allowed commands do, like with env_LD_PRELOAD.
+	Commands []string `yaml:"commands,omitempty"`
+	// Env lists the environment variables that refs can set with env_<NAME>.
+	Env []string `yaml:"env,omitempty"`
+	// Args allows the args parameter.
+	Args bool `yaml:"args,omitempty"`
+}
+
+type FilePolicy struct {
+	// Paths lists the only directories or files that can be read.
+	// Relative paths are relative to the working directory.
+	Paths []string `yaml:"paths,omitempty"`
+}
+
+type HostPolicy struct {
+	// Hosts lists the only hosts that can be queried. "*.example.com" allows any subdomain of example.com.
+	Hosts []string `yaml:"hosts,omitempty"`
+}
+
+// PolicyViolationError is returned when a ref is not allowed by Options.Policy.
+type PolicyViolationError struct {
+	Scheme string
+	Reason string
+}
+
+func (e *PolicyViolationError) Error() string {
+	return fmt.Sprintf("policy violation: %s", e.Reason)
+}
+
+// LoadPolicy reads a Policy from a YAML file.
+func LoadPolicy(path string) (*Policy, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Policy
+	if err := yaml.Unmarshal(bs, &p); err != nil {
+		return nil, fmt.Errorf("parsing policy %s: %w", path, err)
+	}
+
+	return &p, nil
+}
+
+// Check returns a *PolicyViolationError when the ref denoted by the uri is not allowed.
+// A nil policy allows everything.
+func (p *Policy) Check(uri *url.URL) error {
+	if p == nil {
+		return nil
+	}
+
+	scheme := uri.Scheme
+
+	violation := func(format string, args ...interface{}) error {
+		return &PolicyViolationError{Scheme: scheme, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if len(p.Schemes.Allow) > 0 && !contains(p.Schemes.Allow, scheme) || contains(p.Schemes.Deny, scheme) {
+		return violation("provider %q is not allowed", scheme)
+	}
+
+	switch scheme {
+	case ProviderExec:
+		if len(p.Exec.Commands) == 0 {
+			return nil
+		}
+		if cmd := execprovider.Command(refPath(uri)); !contains(p.Exec.Commands, cmd) {
+			return violation("command %q is not allowed for provider %q", cmd, scheme)
+		}
+		params := make([]string, 0, len(uri.Query()))
+		for k := range uri.Query() {
+			params = append(params, k)
+		}
+		sort.Strings(params)
+		for _, k := range params {
+			if name, ok := strings.CutPrefix(k, "env_"); ok && !contains(p.Exec.Env, name) {
+				return violation("environment variable %q cannot be set for provider %q", name, scheme)
+			}
+			if k == "args" && !p.Exec.Args {
+				return violation("parameter %q is not allowed for provider %q", k, scheme)
+			}
+		}
+	case ProviderFile:
+		if len(p.File.Paths) == 0 {
+			return nil
+		}
+		path := strings.TrimSuffix(refPath(uri), "/")
+		ok, err := isUnderAnyPath(path, p.File.Paths)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return violation("path %q is not allowed for provider %q", path, scheme)
+		}
+	case ProviderHttpJsonManager:
+		if len(p.HTTPJSON.Hosts) == 0 {
+			return nil
+		}
+		if host := uri.Hostname(); !matchesAnyHost(host, p.HTTPJSON.Hosts) {
+			return violation("host %q is not allowed for provider %q", host, scheme)
+		}
+	}
+
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyHost(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if p == host || strings.HasPrefix(p, "*.") && strings.HasSuffix(host, p[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnderAnyPath reports whether path is one of the prefixes or inside one of them,
+// after resolving "..", symlinks and relative paths.
+func isUnderAnyPath(path string, prefixes []string) (bool, error) {
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return false, err
+	}
+
+	for _, prefix := range prefixes {
+		p, err := resolvePath(prefix)
+		if err != nil {
+			return false, err
+		}
+		if resolved == p || strings.HasPrefix(resolved, strings.TrimSuffix(p, string(filepath.Separator))+string(filepath.Separator)) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	// Symlinks are resolved so that they cannot point out of the allowed paths.
+	// Paths that don't exist yet cannot be read anyway, and are compared as they are.
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved, nil
+	}
+	return abs, nil
+}
@@ -0,0 +1,105 @@
+package vals
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy(t *testing.T) {
+	dir := t.TempDir()
+	allowed := filepath.Join(dir, "allowed")
+	require.NoError(t, os.Mkdir(allowed, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(allowed, "secret.txt"), []byte("s3cr3t"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.txt"), []byte("other"), 0o644))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "other.txt"), filepath.Join(allowed, "link.txt")))
+
+	policyFile := filepath.Join(dir, "policy.yaml")
+	require.NoError(t, os.WriteFile(policyFile, []byte(`
+schemes:
+  allow: [echo, exec, file, httpjson]
+  deny: [echo]
+exec:
+  commands: [echo]
+  env: [FOO]
+file:
+  paths: [`+allowed+`]
+httpjson:
+  hosts: ["*.example.com"]
+`), 0o644))
+
+	policy, err := LoadPolicy(policyFile)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		code     string
+		expected string
+		err      string
+	}{
+		{
+			code:     "ref+exec://echo/foo",
+			expected: "foo",
+		},
+		{
+			code:     "ref+file://" + allowed + "/secret.txt",
+			expected: "s3cr3t",
+		},
+		{
+			code: "ref+echo://foo",
+			err:  `policy violation: provider "echo" is not allowed`,
+		},
+		{
+			code: "ref+envsubst://$HOME",
+			err:  `policy violation: provider "envsubst" is not allowed`,
+		},
+		{
+			code: "ref+exec://rm/-rf/foo",
+			err:  `policy violation: command "rm" is not allowed for provider "exec"`,
+		},
+		{
+			code:     "ref+exec://echo/foo?env_FOO=bar",
+			expected: "foo",
+		},
+		{
+			code: "ref+exec://echo/foo?env_LD_PRELOAD=/tmp/x.so",
+			err:  `policy violation: environment variable "LD_PRELOAD" cannot be set for provider "exec"`,
+		},
+		{
+			code: "ref+exec://echo/foo?args=-e,bar",
+			err:  `policy violation: parameter "args" is not allowed for provider "exec"`,
+		},
+		{
+			code: "ref+exec:///bin/echo/foo",
+			err:  `policy violation: command "/bin/echo/foo" is not allowed for provider "exec"`,
+		},
+		{
+			code: "ref+file://" + allowed + "/../other.txt",
+			err:  `policy violation: path "` + allowed + `/../other.txt" is not allowed for provider "file"`,
+		},
+		{
+			code: "ref+file://" + allowed + "/link.txt",
+			err:  `policy violation: path "` + allowed + `/link.txt" is not allowed for provider "file"`,
+		},
+		{
+			code: "ref+httpjson://api.github.com/repos#///name",
+			err:  `policy violation: host "api.github.com" is not allowed for provider "httpjson"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.code, func(t *testing.T) {
+			got, err := Get(tc.code, Options{Policy: policy})
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				var violation *PolicyViolationError
+				require.True(t, errors.As(err, &violation))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, got)
+		})
+	}
+}
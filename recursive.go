@@ -0,0 +1,101 @@
+package vals
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/helmfile/vals/pkg/expansion"
+)
+
+// DefaultRecursionDepth is the default of Options.RecursionDepth.
+const DefaultRecursionDepth = 10
+
+// recursiveResolver resolves the refs found in the values fetched by refs, for Options.Recursive.
+type recursiveResolver struct {
+	next   func(string) (interface{}, error)
+	expand *expansion.ExpandRegexMatch
+
+	maxDepth int
+	// chain lists the refs being resolved, to detect cycles and to show how a failing ref was reached.
+	chain []string
+	// resolved are the values whose refs are resolved, by ref.
+	resolved map[string]interface{}
+}
+
+// newRecursiveResolver makes expand resolve the refs in the values that it looks up.
+func newRecursiveResolver(r *Runtime, expand *expansion.ExpandRegexMatch) {
+	maxDepth := r.Options.RecursionDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultRecursionDepth
+	}
+
+	s := &recursiveResolver{
+		next:     expand.Lookup,
+		expand:   expand,
+		maxDepth: maxDepth,
+		resolved: map[string]interface{}{},
+	}
+	expand.Lookup = s.lookup
+}
+
+func (s *recursiveResolver) lookup(key string) (interface{}, error) {
+	if v, ok := s.resolved[key]; ok {
+		return v, nil
+	}
+
+	for i, k := range s.chain {
+		if k == key {
+			return nil, fmt.Errorf("cycle in refs: %s", formatRefChain(append(append([]string(nil), s.chain[i:]...), key)))
+		}
+	}
+	// The chain holds the refs whose values led to this one, the first being a ref of the template,
+	// so that its length is the level of the ref below the template, which may be maxDepth at most.
+	if len(s.chain) > s.maxDepth {
+		return nil, fmt.Errorf("maximum recursion depth (%d) exceeded: %s", s.maxDepth, formatRefChain(append(append([]string(nil), s.chain...), key)))
+	}
+
+	v, err := s.next(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s.chain = append(s.chain, key)
+	res, err := s.eval(v)
+	s.chain = s.chain[:len(s.chain)-1]
+	if err != nil {
+		return nil, fmt.Errorf("resolving the refs in the value of %s: %w", key, err)
+	}
+
+	s.resolved[key] = res
+	return res, nil
+}
+
+// eval resolves the refs in v. Maps are copied first, as they may be cached by the runtime.
+func (s *recursiveResolver) eval(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return s.expand.InValue(v)
+	case map[string]interface{}:
+		return s.expand.InMap(copyMap(v))
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			r, err := s.eval(item)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = r
+		}
+		return res, nil
+	default:
+		return v, nil
+	}
+}
+
+func formatRefChain(keys []string) string {
+	refs := make([]string, len(keys))
+	for i, k := range keys {
+		refs[i] = "ref+" + k
+	}
+	return strings.Join(refs, " -> ")
+}
@@ -0,0 +1,94 @@
+package vals
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEval_Recursive(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "shared.yaml")
+	write := func(path, content string) {
+		t.Helper()
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	write(shared, `db:
+  host: ref+echo://db.example.com
+  url: postgres://ref+file://`+shared+`#/db/host+/app
+list:
+- ref+echo://aa
+`)
+
+	template := func() map[string]interface{} {
+		return map[string]interface{}{
+			"url":  "ref+file://" + shared + "#/db/url",
+			"db":   "ref+file://" + shared + "#/db",
+			"list": "ref+file://" + shared + "#/list",
+		}
+	}
+
+	res, err := Eval(template())
+	require.NoError(t, err)
+	require.Equal(t, "postgres://ref+file://"+shared+"#/db/host+/app", res["url"])
+
+	res, err = Eval(template(), Options{Recursive: true})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"url": "postgres://db.example.com/app",
+		"db": map[string]interface{}{
+			"host": "db.example.com",
+			"url":  "postgres://db.example.com/app",
+		},
+		"list": []interface{}{"aa"},
+	}, res)
+
+	t.Run("depth", func(t *testing.T) {
+		_, err := Get("ref+file://"+shared+"#/db/url", Options{Recursive: true, RecursionDepth: 1})
+		require.ErrorContains(t, err, "maximum recursion depth (1) exceeded: ref+file://"+shared+"#/db/url -> ref+file://"+shared+"#/db/host -> ref+echo://db.example.com")
+
+		v, err := Get("ref+file://"+shared+"#/db/url", Options{Recursive: true, RecursionDepth: 2})
+		require.NoError(t, err)
+		require.Equal(t, "postgres://db.example.com/app", v)
+	})
+
+	t.Run("depth limit", func(t *testing.T) {
+		// levels(n) returns a ref whose value has refs nested n levels deep.
+		levels := func(n int) string {
+			d := t.TempDir()
+			path := func(i int) string { return filepath.Join(d, strconv.Itoa(i)) }
+			for i := 0; i < n; i++ {
+				write(path(i), "ref+file://"+path(i+1))
+			}
+			write(path(n), "done")
+			return "ref+file://" + path(0)
+		}
+
+		v, err := Get(levels(DefaultRecursionDepth), Options{Recursive: true})
+		require.NoError(t, err)
+		require.Equal(t, "done", v)
+
+		_, err = Get(levels(DefaultRecursionDepth+1), Options{Recursive: true})
+		require.ErrorContains(t, err, fmt.Sprintf("maximum recursion depth (%d) exceeded", DefaultRecursionDepth))
+
+		v, err = Get(levels(3), Options{Recursive: true, RecursionDepth: 3})
+		require.NoError(t, err)
+		require.Equal(t, "done", v)
+
+		_, err = Get(levels(4), Options{Recursive: true, RecursionDepth: 3})
+		require.ErrorContains(t, err, "maximum recursion depth (3) exceeded")
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+		write(a, "ref+file://"+b)
+		write(b, "ref+file://"+a)
+
+		_, err := Get("ref+file://"+a, Options{Recursive: true})
+		require.ErrorContains(t, err, "cycle in refs: ref+file://"+a+" -> ref+file://"+b+" -> ref+file://"+a)
+	})
+}
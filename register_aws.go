@@ -16,14 +16,60 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderS3, func(l *log.Logger, conf config.MapConfig, awsLogLevel string) (api.Provider, error) {
 		return s3.New(l, conf, awsLogLevel), nil
+	}, registry.Metadata{
+		Description: "Objects in AWS S3",
+		BuildTag:    "aws",
+		Params: []registry.Param{
+			{Name: "region", Type: "string", Description: "AWS region", Env: []string{"AWS_REGION", "AWS_DEFAULT_REGION"}},
+			{Name: "profile", Type: "string", Description: "AWS shared config profile", Env: []string{"AWS_PROFILE"}},
+			{Name: "role_arn", Type: "string", Description: "ARN of the IAM role to assume"},
+			{Name: "version_id", Type: "string", Description: "Version of the object"},
+			{Name: "version", Type: "string", Description: "Alias of version_id"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 	registry.RegisterProvider(ProviderSSM, func(l *log.Logger, conf config.MapConfig, awsLogLevel string) (api.Provider, error) {
 		return ssm.New(l, conf, awsLogLevel), nil
+	}, registry.Metadata{
+		Description: "Parameters in AWS SSM Parameter Store",
+		BuildTag:    "aws",
+		Params: []registry.Param{
+			{Name: "region", Type: "string", Description: "AWS region", Env: []string{"AWS_REGION", "AWS_DEFAULT_REGION"}},
+			{Name: "profile", Type: "string", Description: "AWS shared config profile", Env: []string{"AWS_PROFILE"}},
+			{Name: "role_arn", Type: "string", Description: "ARN of the IAM role to assume"},
+			{Name: "version", Type: "int", Description: "Version of the parameter"},
+			{Name: "mode", Type: "enum", Description: "Set to singleparam to fetch a single parameter as a map", Values: []string{"singleparam"}},
+			{Name: "recursive", Type: "bool", Description: "Fetch the parameters under the path recursively", Default: "false"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 	registry.RegisterProvider(ProviderSecretsManager, func(l *log.Logger, conf config.MapConfig, awsLogLevel string) (api.Provider, error) {
 		return awssecrets.New(l, conf, awsLogLevel), nil
+	}, registry.Metadata{
+		Description: "Secrets in AWS Secrets Manager",
+		BuildTag:    "aws",
+		Params: []registry.Param{
+			{Name: "region", Type: "string", Description: "AWS region", Env: []string{"AWS_REGION", "AWS_DEFAULT_REGION"}},
+			{Name: "profile", Type: "string", Description: "AWS shared config profile", Env: []string{"AWS_PROFILE"}},
+			{Name: "role_arn", Type: "string", Description: "ARN of the IAM role to assume"},
+			{Name: "version_stage", Type: "string", Description: "Staging label of the secret version"},
+			{Name: "version_id", Type: "string", Description: "Version of the secret"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 	registry.RegisterProvider(ProviderKms, func(_ *log.Logger, conf config.MapConfig, awsLogLevel string) (api.Provider, error) {
 		return awskms.New(conf, awsLogLevel), nil
+	}, registry.Metadata{
+		Description: "Data decrypted by AWS KMS",
+		BuildTag:    "aws",
+		Params: []registry.Param{
+			{Name: "region", Type: "string", Description: "AWS region", Env: []string{"AWS_REGION", "AWS_DEFAULT_REGION"}},
+			{Name: "profile", Type: "string", Description: "AWS shared config profile", Env: []string{"AWS_PROFILE"}},
+			{Name: "role_arn", Type: "string", Description: "ARN of the IAM role to assume"},
+			{Name: "key", Type: "string", Description: "ID or ARN of the KMS key"},
+			{Name: "alg", Type: "string", Description: "Encryption algorithm"},
+			{Name: "context", Type: "string", Description: "JSON-encoded encryption context"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
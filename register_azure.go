@@ -13,5 +13,9 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderAzureKeyVault, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return azurekeyvault.New(conf), nil
+	}, registry.Metadata{
+		Description:  "Secrets in Azure Key Vault",
+		BuildTag:     "azure",
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
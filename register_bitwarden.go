@@ -13,5 +13,12 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderBitwarden, func(l *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return bitwarden.New(l, conf), nil
+	}, registry.Metadata{
+		Description: "Secrets in Bitwarden via the bw serve API",
+		BuildTag:    "bitwarden",
+		Params: []registry.Param{
+			{Name: "address", Type: "string", Description: "Address of bw serve", Default: "http://localhost:8087", Env: []string{"BW_API_ADDR"}},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
@@ -0,0 +1,49 @@
+package vals
+
+import (
+	"github.com/helmfile/vals/pkg/api"
+	"github.com/helmfile/vals/pkg/config"
+	"github.com/helmfile/vals/pkg/log"
+	"github.com/helmfile/vals/pkg/providers/echo"
+	"github.com/helmfile/vals/pkg/providers/envsubst"
+	execprovider "github.com/helmfile/vals/pkg/providers/exec"
+	"github.com/helmfile/vals/pkg/providers/file"
+	"github.com/helmfile/vals/pkg/providers/registry"
+)
+
+// The builtin providers are always available, regardless of build tags.
+func init() {
+	registry.RegisterProvider(ProviderEcho, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
+		return echo.New(conf), nil
+	}, registry.Metadata{
+		Description:  "The path itself, for testing and for splicing literals",
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
+	})
+	registry.RegisterProvider(ProviderFile, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
+		return file.New(conf), nil
+	}, registry.Metadata{
+		Description: "Contents of local files",
+		Params: []registry.Param{
+			{Name: "encode", Type: "enum", Description: "Encoding applied to the content", Values: []string{"raw", "base64"}, Default: "raw"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
+	})
+	registry.RegisterProvider(ProviderEnvSubst, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
+		return envsubst.New(conf), nil
+	}, registry.Metadata{
+		Description:  "The path with environment variables substituted",
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
+	})
+	registry.RegisterProvider(ProviderExec, func(l *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
+		return execprovider.New(l, conf), nil
+	}, registry.Metadata{
+		Description: "Output of local commands",
+		Params: []registry.Param{
+			{Name: "args", Type: "string", Description: "Comma-separated arguments to the command"},
+			{Name: "timeout", Type: "int", Description: "Timeout in seconds", Default: "30"},
+			{Name: "trim", Type: "bool", Description: "Trim the trailing whitespace of the output", Default: "true"},
+			{Name: "env_", Type: "string", Description: "Environment variable passed to the command, e.g. env_FOO=bar", Prefix: true},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
+	})
+}
@@ -13,5 +13,15 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderConjur, func(l *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return conjur.New(l, conf), nil
+	}, registry.Metadata{
+		Description: "Secrets in CyberArk Conjur",
+		BuildTag:    "conjur",
+		Params: []registry.Param{
+			{Name: "address", Type: "string", Description: "Conjur appliance URL", Env: []string{"CONJUR_APPLIANCE_URL"}},
+			{Name: "account", Type: "string", Description: "Conjur account", Env: []string{"CONJUR_ACCOUNT"}},
+			{Name: "login", Type: "string", Description: "Conjur login", Env: []string{"CONJUR_AUTHN_LOGIN"}},
+			{Name: "apikey", Type: "string", Description: "Conjur API key", Sensitive: true, Env: []string{"CONJUR_AUTHN_API_KEY"}},
+		},
+		Capabilities: registry.Capabilities{},
 	})
 }
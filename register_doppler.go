@@ -13,5 +13,19 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderDoppler, func(l *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return doppler.New(l, conf), nil
+	}, registry.Metadata{
+		Description: "Secrets in Doppler",
+		BuildTag:    "doppler",
+		Params: []registry.Param{
+			{Name: "address", Type: "string", Description: "Doppler API address", Default: "https://api.doppler.com", Env: []string{"DOPPLER_API_ADDR"}},
+			{Name: "proto", Type: "enum", Description: "Protocol used with host", Values: []string{"http", "https"}, Default: "https"},
+			{Name: "host", Type: "string", Description: "Doppler API host"},
+			{Name: "token", Type: "string", Description: "Doppler service token", Sensitive: true, Env: []string{"DOPPLER_TOKEN"}},
+			{Name: "project", Type: "string", Description: "Doppler project", Env: []string{"DOPPLER_PROJECT"}},
+			{Name: "config", Type: "string", Description: "Doppler config", Env: []string{"DOPPLER_ENVIRONMENT"}},
+			{Name: "include_doppler_defaults", Type: "flag", Description: "Include the DOPPLER_* variables"},
+			{Name: "no_verify_tls", Type: "flag", Description: "Skip TLS certificate verification"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
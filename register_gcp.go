@@ -16,14 +16,48 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderGCS, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return gcs.New(conf), nil
+	}, registry.Metadata{
+		Description: "Objects in Google Cloud Storage",
+		BuildTag:    "gcp",
+		Params: []registry.Param{
+			{Name: "generation", Type: "int", Description: "Generation of the object"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 	registry.RegisterProvider(ProviderGCPSecretManager, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return gcpsecrets.New(conf), nil
+	}, registry.Metadata{
+		Description: "Secrets in Google Cloud Secret Manager",
+		BuildTag:    "gcp",
+		Params: []registry.Param{
+			{Name: "version", Type: "string", Description: "Version of the secret", Default: "latest"},
+			{Name: "optional", Type: "bool", Description: "Return the fallback value instead of failing when the secret is missing", Default: "false"},
+			{Name: "fallback_value", Type: "string", Description: "Value returned for a missing optional secret"},
+			{Name: "trim_nl", Type: "bool", Description: "Trim the trailing newline", Default: "false"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 	registry.RegisterProvider(ProviderGKMS, func(l *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return gkms.New(l, conf), nil
+	}, registry.Metadata{
+		Description: "Data decrypted by Google Cloud KMS",
+		BuildTag:    "gcp",
+		Params: []registry.Param{
+			{Name: "project", Type: "string", Description: "GCP project", Required: true},
+			{Name: "location", Type: "string", Description: "Location of the key ring", Required: true},
+			{Name: "keyring", Type: "string", Description: "Key ring name", Required: true},
+			{Name: "crypto_key", Type: "string", Description: "Crypto key name", Required: true},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 	registry.RegisterProvider(ProviderGoogleSheets, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return googlesheets.New(conf), nil
+	}, registry.Metadata{
+		Description: "Values in Google Sheets",
+		BuildTag:    "gcp",
+		Params: []registry.Param{
+			{Name: "credentials_file", Type: "string", Description: "Service account credentials file"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
@@ -13,5 +13,14 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderGitLab, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return gitlab.New(conf), nil
+	}, registry.Metadata{
+		Description: "CI/CD variables in GitLab projects",
+		BuildTag:    "gitlab",
+		Params: []registry.Param{
+			{Name: "scheme", Type: "enum", Description: "Scheme of the GitLab API", Values: []string{"http", "https"}, Default: "https"},
+			{Name: "api_version", Type: "string", Description: "GitLab API version", Default: "v4"},
+			{Name: "ssl_verify", Type: "bool", Description: "Verify the TLS certificate", Default: "true"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
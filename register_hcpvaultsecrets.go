@@ -13,5 +13,18 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderHCPVaultSecrets, func(l *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return hcpvaultsecrets.New(l, conf), nil
+	}, registry.Metadata{
+		Description: "Secrets in HCP Vault Secrets",
+		BuildTag:    "hcpvaultsecrets",
+		Params: []registry.Param{
+			{Name: "client_id", Type: "string", Description: "HCP service principal client ID", Env: []string{"HCP_CLIENT_ID"}},
+			{Name: "client_secret", Type: "string", Description: "HCP service principal client secret", Sensitive: true, Env: []string{"HCP_CLIENT_SECRET"}},
+			{Name: "organization_id", Type: "string", Description: "HCP organization ID", Env: []string{"HCP_ORGANIZATION_ID"}},
+			{Name: "organization_name", Type: "string", Description: "HCP organization name", Env: []string{"HCP_ORGANIZATION_NAME"}},
+			{Name: "project_id", Type: "string", Description: "HCP project ID", Env: []string{"HCP_PROJECT_ID"}},
+			{Name: "project_name", Type: "string", Description: "HCP project name", Env: []string{"HCP_PROJECT_NAME"}},
+			{Name: "version", Type: "int", Description: "Version of the secret"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
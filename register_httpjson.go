@@ -13,5 +13,13 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderHttpJsonManager, func(l *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return httpjson.New(l, conf), nil
+	}, registry.Metadata{
+		Description: "Values in JSON documents served over HTTP",
+		BuildTag:    "httpjson",
+		Params: []registry.Param{
+			{Name: "insecure", Type: "bool", Description: "Use http instead of https", Default: "false"},
+			{Name: "floatAsInt", Type: "bool", Description: "Convert floats without a fractional part to integers", Default: "false"},
+		},
+		Capabilities: registry.Capabilities{Fragment: true},
 	})
 }
@@ -13,5 +13,17 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderInfisical, func(l *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return infisical.New(l, conf), nil
+	}, registry.Metadata{
+		Description: "Secrets in Infisical",
+		BuildTag:    "infisical",
+		Params: []registry.Param{
+			{Name: "project", Type: "string", Description: "Project slug"},
+			{Name: "project_id", Type: "string", Description: "Project ID"},
+			{Name: "environment", Type: "string", Description: "Environment slug"},
+			{Name: "path", Type: "string", Description: "Secret path", Default: "/"},
+			{Name: "type", Type: "enum", Description: "Secret type", Values: []string{"shared", "personal"}},
+			{Name: "version", Type: "int", Description: "Version of the secret"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
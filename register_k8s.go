@@ -13,5 +13,14 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderK8s, func(l *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return k8s.New(l, conf)
+	}, registry.Metadata{
+		Description: "Secrets and ConfigMaps in Kubernetes",
+		BuildTag:    "k8s",
+		Params: []registry.Param{
+			{Name: "kubeConfigPath", Type: "string", Description: "Path to the kubeconfig", Env: []string{"KUBECONFIG"}},
+			{Name: "kubeContext", Type: "string", Description: "kubeconfig context"},
+			{Name: "inCluster", Type: "flag", Description: "Use the in-cluster configuration"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
@@ -13,5 +13,9 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderKeychain, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return keychain.New(conf), nil
+	}, registry.Metadata{
+		Description:  "Secrets in the macOS keychain",
+		BuildTag:     "keychain",
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
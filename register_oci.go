@@ -13,5 +13,12 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderOCI, func(l *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return oci.New(l, conf), nil
+	}, registry.Metadata{
+		Description: "Artifacts in OCI registries",
+		BuildTag:    "oci",
+		Params: []registry.Param{
+			{Name: "annotation", Type: "string", Description: "Annotation to read instead of the layer content"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
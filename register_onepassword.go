@@ -14,8 +14,16 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderOnePassword, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return onepassword.New(conf), nil
+	}, registry.Metadata{
+		Description:  "Secrets in 1Password via a service account",
+		BuildTag:     "onepassword",
+		Capabilities: registry.Capabilities{},
 	})
 	registry.RegisterProvider(ProviderOnePasswordConnect, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return onepasswordconnect.New(conf), nil
+	}, registry.Metadata{
+		Description:  "Secrets in 1Password Connect",
+		BuildTag:     "onepassword",
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
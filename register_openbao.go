@@ -13,5 +13,25 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderOpenBao, func(l *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return openbao.New(l, conf), nil
+	}, registry.Metadata{
+		Description: "Secrets in OpenBao",
+		BuildTag:    "openbao",
+		Params: []registry.Param{
+			{Name: "address", Type: "string", Description: "OpenBao server address, taking precedence over proto and host", Env: []string{"BAO_ADDR"}},
+			{Name: "proto", Type: "enum", Description: "Protocol used with host", Values: []string{"http", "https"}, Default: "https"},
+			{Name: "host", Type: "string", Description: "OpenBao server host"},
+			{Name: "namespace", Type: "string", Description: "OpenBao namespace"},
+			{Name: "auth_method", Type: "enum", Description: "Authentication method", Values: []string{"token", "approle", "kubernetes", "userpass"}, Default: "token", Env: []string{"BAO_AUTH_METHOD"}},
+			{Name: "token_env", Type: "string", Description: "Environment variable to read the token from"},
+			{Name: "token_file", Type: "string", Description: "File to read the token from", Env: []string{"BAO_TOKEN_FILE"}},
+			{Name: "role_id", Type: "string", Description: "AppRole role ID", Env: []string{"BAO_ROLE_ID"}},
+			{Name: "secret_id", Type: "string", Description: "AppRole secret ID", Sensitive: true, Env: []string{"BAO_SECRET_ID"}},
+			{Name: "username", Type: "string", Description: "Username for the userpass auth method", Env: []string{"BAO_USERNAME"}},
+			{Name: "password_env", Type: "string", Description: "Environment variable to read the userpass password from", Env: []string{"BAO_PASSWORD_ENV"}},
+			{Name: "password_file", Type: "string", Description: "File to read the userpass password from", Env: []string{"BAO_PASSWORD_FILE"}},
+			{Name: "version", Type: "int", Description: "Version of the KV v2 secret"},
+			{Name: "decode", Type: "enum", Description: "Decoding applied to the value", Values: []string{"raw", "base64"}, Default: "raw"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
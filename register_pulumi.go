@@ -13,5 +13,15 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderPulumiStateAPI, func(l *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return pulumi.New(l, conf, "pulumistateapi"), nil
+	}, registry.Metadata{
+		Description: "Resources in Pulumi Cloud stack states",
+		BuildTag:    "pulumi",
+		Params: []registry.Param{
+			{Name: "pulumi_api_endpoint_url", Type: "string", Description: "Pulumi Cloud API endpoint", Default: "https://api.pulumi.com", Env: []string{"PULUMI_API_ENDPOINT_URL"}},
+			{Name: "organization", Type: "string", Description: "Pulumi organization", Env: []string{"PULUMI_ORGANIZATION"}},
+			{Name: "project", Type: "string", Description: "Pulumi project", Env: []string{"PULUMI_PROJECT"}},
+			{Name: "stack", Type: "string", Description: "Pulumi stack", Env: []string{"PULUMI_STACK"}},
+		},
+		Capabilities: registry.Capabilities{},
 	})
 }
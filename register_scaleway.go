@@ -13,5 +13,9 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderScaleway, func(l *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return scaleway.New(l, conf), nil
+	}, registry.Metadata{
+		Description:  "Secrets in Scaleway Secret Manager",
+		BuildTag:     "scaleway",
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
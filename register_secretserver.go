@@ -13,5 +13,12 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderSecretserver, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return secretserver.New(conf)
+	}, registry.Metadata{
+		Description: "Secrets in Delinea Secret Server",
+		BuildTag:    "secretserver",
+		Params: []registry.Param{
+			{Name: "ssl_verify", Type: "bool", Description: "Verify the TLS certificate", Default: "true"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
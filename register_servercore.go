@@ -13,5 +13,9 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderServercore, func(l *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return servercore.New(l, conf), nil
+	}, registry.Metadata{
+		Description:  "Secrets in Servercore Secrets Manager",
+		BuildTag:     "servercore",
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
@@ -13,5 +13,16 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderSOPS, func(l *log.Logger, conf config.MapConfig, awsLogLevel string) (api.Provider, error) {
 		return sops.New(l, conf, awsLogLevel), nil
+	}, registry.Metadata{
+		Description: "Files and values encrypted with SOPS",
+		BuildTag:    "sops",
+		Params: []registry.Param{
+			{Name: "key_type", Type: "enum", Description: "How the path is interpreted", Values: []string{"filepath", "base64"}, Default: "filepath"},
+			{Name: "format", Type: "enum", Description: "Format of the encrypted data", Values: []string{"yaml", "json", "dotenv", "ini", "binary"}},
+			{Name: "region", Type: "string", Description: "AWS region", Env: []string{"AWS_REGION", "AWS_DEFAULT_REGION"}},
+			{Name: "profile", Type: "string", Description: "AWS shared config profile", Env: []string{"AWS_PROFILE"}},
+			{Name: "role_arn", Type: "string", Description: "ARN of the IAM role to assume"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
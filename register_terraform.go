@@ -10,23 +10,39 @@ import (
 	"github.com/helmfile/vals/pkg/providers/tfstate"
 )
 
+// tfstateMetadata describes every tfstate* provider, which differ only in the backend the state is read from.
+var tfstateMetadata = registry.Metadata{
+	Description: "Outputs and resource attributes in Terraform states",
+	BuildTag:    "terraform",
+	Params: []registry.Param{
+		{Name: "aws_profile", Type: "string", Description: "AWS profile used to read the state from S3"},
+		{Name: "az_subscription_id", Type: "string", Description: "Azure subscription ID used to read the state from azurerm", Env: []string{"AZURE_SUBSCRIPTION_ID"}},
+		{Name: "gitlab_scheme", Type: "enum", Description: "Scheme of the GitLab HTTP backend", Values: []string{"http", "https"}, Default: "https"},
+		{Name: "gitlab_user", Type: "string", Description: "GitLab user for the HTTP backend", Env: []string{"GITLAB_USER"}},
+		{Name: "gitlab_token", Type: "string", Description: "GitLab token for the HTTP backend", Sensitive: true, Env: []string{"GITLAB_TOKEN"}},
+		{Name: "tfe_token", Type: "string", Description: "Terraform Cloud/Enterprise token for the remote backend", Sensitive: true, Env: []string{"TFE_TOKEN"}},
+		{Name: "tfe_credentials_file", Type: "string", Description: "Terraform CLI credentials file for the remote backend"},
+	},
+	Capabilities: registry.Capabilities{},
+}
+
 func init() {
 	registry.RegisterProvider(ProviderTFState, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return tfstate.New(conf, ""), nil
-	})
+	}, tfstateMetadata)
 	registry.RegisterProvider(ProviderTFStateGS, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return tfstate.New(conf, "gs"), nil
-	})
+	}, tfstateMetadata)
 	registry.RegisterProvider(ProviderTFStateS3, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return tfstate.New(conf, "s3"), nil
-	})
+	}, tfstateMetadata)
 	registry.RegisterProvider(ProviderTFStateAzureRM, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return tfstate.New(conf, "azurerm"), nil
-	})
+	}, tfstateMetadata)
 	registry.RegisterProvider(ProviderTFStateRemote, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return tfstate.New(conf, "remote"), nil
-	})
+	}, tfstateMetadata)
 	registry.RegisterProvider(ProviderTFStateGitLab, func(_ *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return tfstate.New(conf, "gitlab"), nil
-	})
+	}, tfstateMetadata)
 }
@@ -13,5 +13,12 @@ import (
 func init() {
 	registry.RegisterProvider(ProviderLockbox, func(l *log.Logger, conf config.MapConfig, _ string) (api.Provider, error) {
 		return yclockbox.New(l, conf), nil
+	}, registry.Metadata{
+		Description: "Secrets in Yandex Cloud Lockbox",
+		BuildTag:    "yclockbox",
+		Params: []registry.Param{
+			{Name: "version_id", Type: "string", Description: "Version of the secret"},
+		},
+		Capabilities: registry.Capabilities{StringMap: true, Fragment: true},
 	})
 }
@@ -0,0 +1,181 @@
+package vals
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/helmfile/vals/pkg/api"
+	"github.com/helmfile/vals/pkg/config"
+	"github.com/helmfile/vals/pkg/expansion"
+	"github.com/helmfile/vals/pkg/log"
+	"github.com/helmfile/vals/pkg/providers/registry"
+)
+
+// errSelfOutsideDocument is returned for ref+self:// expressions found outside of a document, like in Get or Flatten.
+var errSelfOutsideDocument = errors.New("ref+self:// can only be used within a document evaluated by Eval or EvalNodes")
+
+func init() {
+	registry.RegisterProvider(ProviderSelf, func(_ *log.Logger, _ config.MapConfig, _ string) (api.Provider, error) {
+		return nil, errSelfOutsideDocument
+	}, registry.Metadata{
+		Description:  "Another value of the document being evaluated, like ref+self://#/db/host, with its refs resolved",
+		Capabilities: registry.Capabilities{Fragment: true},
+	})
+}
+
+// selfResolver resolves ref+self://#/path/to/key expressions against the document being evaluated.
+// The refs in the value at the path are resolved first, in the order of the dependencies between the values,
+// and each value is resolved once.
+type selfResolver struct {
+	doc    interface{}
+	next   func(string) (interface{}, error)
+	expand *expansion.ExpandRegexMatch
+
+	failOnMissingKeyInMap bool
+
+	resolved map[string]interface{}
+	// resolving lists the paths being resolved, to detect cycles.
+	resolving []string
+}
+
+// prepareDocument is like prepare, but resolves the ref+self:// expressions in doc, which is the whole document being evaluated.
+func (r *Runtime) prepareDocument(doc interface{}) (*expansion.ExpandRegexMatch, error) {
+	expand, err := r.prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasSelfRef(doc) {
+		return expand, nil
+	}
+
+	s := &selfResolver{
+		// The document is copied, as the evaluation replaces its values in place.
+		doc:                   copyValue(doc),
+		next:                  expand.Lookup,
+		expand:                expand,
+		failOnMissingKeyInMap: r.Options.FailOnMissingKeyInMap,
+		resolved:              map[string]interface{}{},
+	}
+	expand.Lookup = s.lookup
+
+	return expand, nil
+}
+
+func (s *selfResolver) lookup(key string) (interface{}, error) {
+	if !strings.HasPrefix(key, ProviderSelf+"://") {
+		return s.next(key)
+	}
+
+	uri, err := parseRefURI(key)
+	if err != nil {
+		return nil, err
+	}
+	path := strings.TrimPrefix(uri.Fragment, "/")
+	if uri.Host != "" || uri.Path != "" || uri.RawQuery != "" || path == "" {
+		return nil, fmt.Errorf("invalid ref+%s: expected ref+self://#/path/to/key", key)
+	}
+
+	if v, ok := s.resolved[path]; ok {
+		return v, nil
+	}
+
+	for i, p := range s.resolving {
+		if p == path {
+			cycle := append(append([]string(nil), s.resolving[i:]...), path)
+			return nil, fmt.Errorf("cycle in ref+self:// expressions: #/%s", strings.Join(cycle, " -> #/"))
+		}
+	}
+
+	v, found, err := selfValue(s.doc, path)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		if s.failOnMissingKeyInMap {
+			return nil, fmt.Errorf("no value found for key %s", path)
+		}
+		return nil, nil
+	}
+
+	s.resolving = append(s.resolving, path)
+	res, err := s.eval(copyValue(v))
+	s.resolving = s.resolving[:len(s.resolving)-1]
+	if err != nil {
+		return nil, err
+	}
+
+	s.resolved[path] = res
+	return res, nil
+}
+
+func (s *selfResolver) eval(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return s.expand.InValue(v)
+	case map[string]interface{}:
+		return s.expand.InMap(v)
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			r, err := s.eval(item)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = r
+		}
+		return res, nil
+	default:
+		return v, nil
+	}
+}
+
+// selfValue returns the value at the slash-separated path in doc, whose components are keys of maps or indices of lists.
+func selfValue(doc interface{}, path string) (interface{}, bool, error) {
+	v := doc
+	for _, k := range strings.Split(path, "/") {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			item, ok := t[k]
+			if !ok {
+				return nil, false, nil
+			}
+			v = item
+		case []interface{}:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 {
+				return nil, false, fmt.Errorf("unexpected index %q at %s: expected a non-negative integer", k, path)
+			}
+			if i >= len(t) {
+				return nil, false, nil
+			}
+			v = t[i]
+		default:
+			return nil, false, fmt.Errorf("unexpected type of value at %s: expected a map or a list, got %v(%T)", path, t, t)
+		}
+	}
+	return v, true, nil
+}
+
+// hasSelfRef reports whether any string in v contains a ref+self:// expression.
+func hasSelfRef(v interface{}) bool {
+	switch v := v.(type) {
+	case string:
+		return strings.Contains(v, "ref+"+ProviderSelf+"://")
+	case map[string]interface{}:
+		for _, item := range v {
+			if hasSelfRef(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if hasSelfRef(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
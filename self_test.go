@@ -0,0 +1,82 @@
+package vals
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEval_Self(t *testing.T) {
+	res, err := Eval(map[string]interface{}{
+		"db": map[string]interface{}{
+			"host": "ref+echo://db.example.com",
+			"port": 5432,
+		},
+		"urls": map[string]interface{}{
+			"primary": "postgres://ref+self://#/db/host+:ref+self://#/db/port+/app",
+			"replica": "ref+self://#/urls/primary+?replica=1",
+		},
+		"port":  "ref+self://#/db/port",
+		"copy":  "ref+self://#/db",
+		"first": "ref+self://#/list/0",
+		"list":  []interface{}{"ref+echo://aa", "bb"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"db": map[string]interface{}{
+			"host": "db.example.com",
+			"port": 5432,
+		},
+		"urls": map[string]interface{}{
+			"primary": "postgres://db.example.com:5432/app",
+			"replica": "postgres://db.example.com:5432/app?replica=1",
+		},
+		"port": 5432,
+		"copy": map[string]interface{}{
+			"host": "db.example.com",
+			"port": 5432,
+		},
+		"first": "aa",
+		"list":  []interface{}{"aa", "bb"},
+	}, res)
+
+	t.Run("cycle", func(t *testing.T) {
+		_, err := Eval(map[string]interface{}{
+			"a": "ref+self://#/b",
+			"b": "ref+self://#/c",
+			"c": "x-ref+self://#/a",
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "cycle in ref+self:// expressions: ")
+		cycle := err.Error()[strings.LastIndex(err.Error(), ": ")+2:]
+		require.Contains(t, []string{"#/a -> #/b -> #/c -> #/a", "#/b -> #/c -> #/a -> #/b", "#/c -> #/a -> #/b -> #/c"}, cycle)
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		_, err := Eval(map[string]interface{}{"a": "ref+self://#/b"}, Options{FailOnMissingKeyInMap: true})
+		require.EqualError(t, err, "expand self://#/b: no value found for key b")
+	})
+
+	t.Run("outside of a document", func(t *testing.T) {
+		_, err := Get("ref+self://#/a", Options{})
+		require.EqualError(t, err, "expand self://#/a: "+errSelfOutsideDocument.Error())
+	})
+}
+
+func TestEvalNodes_Self(t *testing.T) {
+	input := `- name: ref+echo://app
+- url: https://ref+self://#/0/name+.example.com
+---
+a: ref+self://#/b
+b: ref+echo://bb
+`
+	nodes, err := nodesFromReader(strings.NewReader(input))
+	require.NoError(t, err)
+	nodes, err = EvalNodes(nodes, Options{})
+	require.NoError(t, err)
+
+	buf := &strings.Builder{}
+	require.NoError(t, Output(buf, FormatYAML, nodes))
+	require.Equal(t, "- name: app\n- url: https://app.example.com\n---\na: bb\nb: bb\n", buf.String())
+}
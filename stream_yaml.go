@@ -1,19 +1,117 @@
 package vals
 
 import (
+	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
 )
 
-func streamYAML(path string, w, log io.Writer) error {
-	nodes, err := Inputs(path)
+// EvalStream reads YAML documents from in, and writes each of them to out as soon as its refs are replaced,
+// so that memory use does not grow with the number of documents, and the first document is written without waiting for the others.
+// The result is the same as that of EvalNodes followed by Output in the YAML format.
+// The documents written before an error remain in out.
+func EvalStream(in io.Reader, out io.Writer, opts Options) error {
+	runtime, err := New(opts)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = runtime.Close() }()
+	return runtime.EvalStream(in, out)
+}
+
+// EvalStream is like the package-level EvalStream, but shares the caches of the runtime.
+func (r *Runtime) EvalStream(in io.Reader, out io.Writer) error {
+	return r.evalStream(in, &documentWriter{w: out})
+}
+
+func (r *Runtime) evalStream(in io.Reader, d *documentWriter) error {
+	return decodeDocuments(in, func(node yaml.Node) error {
+		res, err := r.EvalNodes([]yaml.Node{node})
+		if err != nil {
+			return err
+		}
+		return d.write(res...)
+	})
+}
+
+// documentWriter writes YAML documents one at a time, separated by "---" lines like Output does.
+type documentWriter struct {
+	w io.Writer
+	n int
+}
+
+func (d *documentWriter) write(nodes ...yaml.Node) error {
+	for _, node := range nodes {
+		if d.n > 0 {
+			if _, err := fmt.Fprintln(d.w, "---"); err != nil {
+				return err
+			}
+		}
+		d.n++
+		if err := Output(d.w, FormatYAML, []yaml.Node{node}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamYAML writes the evaluated documents of the file, or of all the files in the directory, at path to w.
+// YAML and JSON files are evaluated one document at a time.
+func streamYAML(path string, w, log io.Writer, policy *Policy) error {
+	runtime, err := New(Options{LogOutput: log, Policy: policy})
 	if err != nil {
 		return err
 	}
+	defer func() { _ = runtime.Close() }()
 
-	nodes, err = EvalNodes(nodes, Options{LogOutput: log})
+	d := &documentWriter{w: w}
+
+	if path == "-" {
+		return runtime.evalStream(os.Stdin, d)
+	}
+
+	info, err := os.Stat(path)
 	if err != nil {
 		return err
 	}
+	if !info.IsDir() {
+		return runtime.streamFile(path, d)
+	}
 
-	return Output(w, "yaml", nodes)
+	paths, err := inputPaths(path, InputsConfig{Recursive: true})
+	if err != nil {
+		return err
+	}
+	for _, rel := range paths {
+		if err := runtime.streamFile(filepath.Join(path, filepath.FromSlash(rel)), d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runtime) streamFile(f string, d *documentWriter) error {
+	switch format := DetectFormat(f); format {
+	case FormatYAML, FormatJSON:
+		fp, err := os.Open(f)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = fp.Close() }()
+		return r.evalStream(fp, d)
+	default:
+		// The other formats are decoded as a whole anyway.
+		file, err := inputFile(f, f, format)
+		if err != nil {
+			return err
+		}
+		nodes, err := r.EvalNodes(file.Nodes)
+		if err != nil {
+			return err
+		}
+		return d.write(nodes...)
+	}
 }
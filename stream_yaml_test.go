@@ -0,0 +1,71 @@
+package vals
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalStream(t *testing.T) {
+	input := `a: ref+echo://aa
+---
+---
+ref+echo://foo/bar
+---
+- ref+echo://xx
+- b: ref+echo://yy
+---
+date: 2024-01-01
+`
+
+	nodes, err := nodesFromReader(strings.NewReader(input))
+	require.NoError(t, err)
+	nodes, err = EvalNodes(nodes, Options{})
+	require.NoError(t, err)
+	expected := &bytes.Buffer{}
+	require.NoError(t, Output(expected, FormatYAML, nodes))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, EvalStream(strings.NewReader(input), buf, Options{}))
+	require.Equal(t, expected.String(), buf.String())
+
+	t.Run("writes each document as soon as it is evaluated", func(t *testing.T) {
+		inR, inW := io.Pipe()
+		outR, outW := io.Pipe()
+
+		done := make(chan error, 1)
+		go func() {
+			done <- EvalStream(inR, outW, Options{})
+			_ = outW.Close()
+		}()
+
+		out := bufio.NewReader(outR)
+
+		// The decoder needs to see the start of the next document to know that the previous one ended.
+		_, err := io.WriteString(inW, "a: ref+echo://aa\n---\nb: ref+echo://bb\n")
+		require.NoError(t, err)
+		line, err := out.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, "a: aa\n", line)
+
+		_, err = io.WriteString(inW, "---\nc: ref+echo://cc\n")
+		require.NoError(t, err)
+		require.NoError(t, inW.Close())
+
+		rest, err := io.ReadAll(out)
+		require.NoError(t, err)
+		require.Equal(t, "---\nb: bb\n---\nc: cc\n", string(rest))
+		require.NoError(t, <-done)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := EvalStream(strings.NewReader("a: ref+echo://aa\n---\nb: ref+nonexistent://bb\n"), buf, Options{})
+		require.Error(t, err)
+		require.Equal(t, "a: aa\n", buf.String())
+	})
+}
@@ -0,0 +1,105 @@
+package vals
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+
+	"github.com/helmfile/vals/pkg/expansion"
+)
+
+// Template renders text as a Go text/template to w.
+//
+// On top of the sprig functions, the template can call:
+//
+//	ref "ref+vault://kv/db#/password"  the value of the expression, preserving its type
+//	refMap "ref+vault://kv/db"         the document at the ref as a map, e.g. to range over
+//
+// Values are fetched only when the template executes these functions,
+// and lookups share the provider clients and caches of the runtime.
+func (r *Runtime) Template(w io.Writer, text string, data interface{}) error {
+	expand, err := r.prepare()
+	if err != nil {
+		return err
+	}
+
+	funcs := sprig.TxtFuncMap()
+	funcs["ref"] = func(s string) (interface{}, error) {
+		if expansion.DefaultRefRegexp.FindStringIndex(s) == nil {
+			return nil, fmt.Errorf("ref: no ref+<provider>:// expression found in %q", s)
+		}
+		return expand.InValue(s)
+	}
+	funcs["refMap"] = func(s string) (map[string]interface{}, error) {
+		return r.refMap(expand, s)
+	}
+
+	tmpl, err := template.New("vals").Funcs(funcs).Parse(text)
+	if err != nil {
+		return err
+	}
+
+	return tmpl.Execute(w, data)
+}
+
+// refMap returns the document denoted by the ref as a map.
+// With a fragment, the value at the fragment must be a map itself.
+// A secretref+ expression cannot be left as-is in place of a map,
+// so it is an error when ExcludeSecret is set.
+func (r *Runtime) refMap(expand *expansion.ExpandRegexMatch, s string) (map[string]interface{}, error) {
+	ixs := expansion.DefaultRefRegexp.FindStringSubmatchIndex(s)
+	if ixs == nil || ixs[0] != 0 || ixs[1] != len(s) {
+		return nil, fmt.Errorf("refMap: expected a single ref+<provider>:// expression, got %q", s)
+	}
+	if r.Options.ExcludeSecret && s[ixs[2]:ixs[3]] == "secretref" {
+		return nil, fmt.Errorf("refMap %s: secretref+ expressions are not evaluated when secrets are excluded", s)
+	}
+	key := s[ixs[6]:ixs[7]]
+
+	uri, err := parseRefURI(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if uri.Fragment != "" {
+		v, err := expand.Lookup(key)
+		if err != nil {
+			return nil, fmt.Errorf("refMap %s: %w", key, err)
+		}
+		m, ok := asStringKeyedMap(v)
+		if !ok {
+			return nil, fmt.Errorf("refMap %s: expected a map, got %v(%T)", key, v, v)
+		}
+		return m, nil
+	}
+
+	p, err := r.providerFor(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := r.getStringMap(strings.TrimSuffix(key, "#"), p, refPath(uri))
+	if err != nil {
+		return nil, fmt.Errorf("refMap %s: %w", key, err)
+	}
+	if r.Options.Recursive {
+		// The document is copied, as it is cached by the runtime.
+		m, err = expand.InMap(copyMap(m))
+		if err != nil {
+			return nil, fmt.Errorf("refMap %s: %w", key, err)
+		}
+	}
+	return m, nil
+}
+
+func Template(w io.Writer, text string, data interface{}, opts Options) error {
+	runtime, err := New(opts)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = runtime.Close() }()
+	return runtime.Template(w, text, data)
+}
@@ -0,0 +1,85 @@
+package vals
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		template string
+		opts     Options
+		expected string
+		err      string
+	}{
+		{
+			name:     "ref",
+			template: `listen {{ ref "ref+echo://port/8080#/port" }};`,
+			expected: `listen 8080;`,
+		},
+		{
+			name:     "ref with interpolation",
+			template: `{{ ref "http://ref+echo://host/example.com#/host+:80" }}`,
+			expected: `http://example.com:80`,
+		},
+		{
+			name:     "refMap with range and sprig",
+			template: `{{ range $k, $v := refMap "ref+echo://upstreams/a/b#/upstreams" }}{{ $k }}={{ $v | upper }}{{ end }}`,
+			expected: `a=B`,
+		},
+		{
+			name:     "refMap without fragment",
+			template: `{{ (refMap "ref+echo://db/host/example.com").db.host }}`,
+			expected: `example.com`,
+		},
+		{
+			name:     "conditional",
+			template: `{{ if eq (ref "ref+echo://env/prod#/env") "prod" }}production{{ else }}other{{ end }}`,
+			expected: `production`,
+		},
+		{
+			name:     "refMap of a scalar",
+			template: `{{ refMap "ref+echo://port/8080#/port" }}`,
+			err:      "expected a map",
+		},
+		{
+			name:     "ref with secrets excluded",
+			template: `{{ ref "ref+echo://a/b#/a" }} {{ ref "secretref+echo://a/b#/a" }}`,
+			opts:     Options{ExcludeSecret: true},
+			expected: `b secretref+echo://a/b#/a`,
+		},
+		{
+			name:     "refMap with secrets excluded",
+			template: `{{ refMap "secretref+echo://db/host/example.com" }}`,
+			opts:     Options{ExcludeSecret: true},
+			err:      "secretref+ expressions are not evaluated when secrets are excluded",
+		},
+		{
+			name:     "refMap of a ref with secrets excluded",
+			template: `{{ (refMap "ref+echo://db/host/example.com").db.host }}`,
+			opts:     Options{ExcludeSecret: true},
+			expected: `example.com`,
+		},
+		{
+			name:     "ref without expression",
+			template: `{{ ref "vault://kv/db" }}`,
+			err:      "no ref+<provider>:// expression found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			err := Template(buf, tc.template, nil, tc.opts)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, buf.String())
+		})
+	}
+}
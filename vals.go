@@ -12,6 +12,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru"
 	"gopkg.in/yaml.v3"
@@ -20,10 +21,7 @@ import (
 	"github.com/helmfile/vals/pkg/config"
 	"github.com/helmfile/vals/pkg/expansion"
 	"github.com/helmfile/vals/pkg/log"
-	"github.com/helmfile/vals/pkg/providers/echo"
-	"github.com/helmfile/vals/pkg/providers/envsubst"
-	execprovider "github.com/helmfile/vals/pkg/providers/exec"
-	"github.com/helmfile/vals/pkg/providers/file"
+	"github.com/helmfile/vals/pkg/providers/plugin"
 	"github.com/helmfile/vals/pkg/providers/registry"
 	"github.com/helmfile/vals/pkg/stringmapprovider"
 	"github.com/helmfile/vals/pkg/stringprovider"
@@ -91,6 +89,7 @@ const (
 	ProviderSecretserver       = "tss"
 	ProviderInfisical          = "infisical"
 	ProviderServercore         = "servercore"
+	ProviderSelf               = "self"
 )
 
 var EnvFallbackPrefix = "VALS_"
@@ -102,6 +101,7 @@ type Evaluator interface {
 // Runtime an object for secrets rendering
 type Runtime struct {
 	providers map[string]api.Provider
+	plugins   map[string]*plugin.Client
 	docCache  *lru.Cache // secret documents are cached to improve performance
 	strCache  *lru.Cache // secrets are cached to improve performance
 	logger    *log.Logger
@@ -117,6 +117,7 @@ func New(opts Options) (*Runtime, error) {
 	}
 	r := &Runtime{
 		providers: map[string]api.Provider{},
+		plugins:   map[string]*plugin.Client{},
 		Options:   opts,
 		logger: log.New(log.Config{
 			Output: opts.LogOutput,
@@ -134,237 +135,323 @@ func New(opts Options) (*Runtime, error) {
 	return r, nil
 }
 
-// nolint
-func (r *Runtime) prepare() (*expansion.ExpandRegexMatch, error) {
-	var err error
+func uriToProviderHash(uri *url.URL) string {
+	bs := []byte{}
+	bs = append(bs, []byte(uri.Scheme)...)
+	query := uri.Query().Encode()
+	bs = append(bs, []byte(query)...)
+	return fmt.Sprintf("%x", md5.Sum(bs))
+}
 
-	uriToProviderHash := func(uri *url.URL) string {
-		bs := []byte{}
-		bs = append(bs, []byte(uri.Scheme)...)
-		query := uri.Query().Encode()
-		bs = append(bs, []byte(query)...)
-		return fmt.Sprintf("%x", md5.Sum(bs))
+func (r *Runtime) createProvider(scheme string, uri *url.URL) (api.Provider, error) {
+	query := uri.Query()
+
+	m := map[string]interface{}{}
+	for key, params := range query {
+		if len(params) > 0 {
+			m[key] = params[0]
+		}
 	}
 
-	createProvider := func(scheme string, uri *url.URL) (api.Provider, error) {
-		query := uri.Query()
+	envFallback := func(k string) string {
+		key := fmt.Sprintf("%s%s", EnvFallbackPrefix, strings.ToUpper(k))
+		return os.Getenv(key)
+	}
 
-		m := map[string]interface{}{}
-		for key, params := range query {
-			if len(params) > 0 {
-				m[key] = params[0]
-			}
+	conf := config.MapConfig{M: m, FallbackFunc: envFallback}
+
+	factory, ok := registry.GetProvider(scheme)
+	if !ok {
+		return r.pluginProvider(scheme, query)
+	}
+	return factory(r.logger, conf, r.Options.AWSLogLevel)
+}
+
+// pluginProvider returns a provider backed by the vals-provider-<scheme> plugin,
+// starting the plugin on first use so that it serves every ref of the scheme.
+func (r *Runtime) pluginProvider(scheme string, query url.Values) (api.Provider, error) {
+	c, ok := r.plugins[scheme]
+	if !ok {
+		path, found := plugin.Find(scheme, r.pluginDirs())
+		if !found {
+			return nil, fmt.Errorf("no provider registered for scheme %q", scheme)
+		}
+
+		perms, ok := r.Options.PluginPermissions[scheme]
+		if !ok {
+			perms = plugin.PermissionsFromEnv(scheme)
 		}
 
-		envFallback := func(k string) string {
-			key := fmt.Sprintf("%s%s", EnvFallbackPrefix, strings.ToUpper(k))
-			return os.Getenv(key)
+		var err error
+		c, err = plugin.Start(scheme, path, perms, r.Options.LogOutput)
+		if err != nil {
+			return nil, err
 		}
 
-		conf := config.MapConfig{M: m, FallbackFunc: envFallback}
+		r.plugins[scheme] = c
+	}
 
-		switch scheme {
-		case ProviderEcho:
-			return echo.New(conf), nil
-		case ProviderFile:
-			return file.New(conf), nil
-		case ProviderEnvSubst:
-			return envsubst.New(conf), nil
-		case ProviderExec:
-			return execprovider.New(r.logger, conf), nil
-		default:
-			if factory, ok := registry.GetProvider(scheme); ok {
-				return factory(r.logger, conf, r.Options.AWSLogLevel)
+	params := map[string]string{}
+	for key, values := range query {
+		if len(values) > 0 {
+			params[key] = values[0]
+		}
+	}
+
+	return c.Provider(params), nil
+}
+
+func (r *Runtime) pluginDirs() []string {
+	if len(r.Options.PluginDirs) > 0 {
+		return r.Options.PluginDirs
+	}
+	return plugin.Dirs()
+}
+
+// Close stops the provider plugins started by the runtime.
+func (r *Runtime) Close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var errs []error
+	for scheme, c := range r.plugins {
+		if err := c.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("stopping plugin for %q: %w", scheme, err))
+		}
+		delete(r.plugins, scheme)
+	}
+	return errors.Join(errs...)
+}
+
+// providerFor returns the provider for the scheme and the parameters of the uri,
+// creating it on first use so that subsequent lookups share its client and session.
+func (r *Runtime) providerFor(uri *url.URL) (api.Provider, error) {
+	if err := r.Options.Policy.Check(uri); err != nil {
+		return nil, err
+	}
+
+	hash := uriToProviderHash(uri)
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	p, ok := r.providers[hash]
+	if !ok {
+		var scheme string
+		scheme = uri.Scheme
+		scheme = strings.Split(scheme, "://")[0]
+
+		var err error
+		p, err = r.createProvider(scheme, uri)
+		if err != nil {
+			return nil, err
+		}
+
+		r.providers[hash] = p
+	}
+	return p, nil
+}
+
+// parseRefURI parses the <provider>://<path>[?params][#fragment] part of a ref expression.
+func parseRefURI(key string) (*url.URL, error) {
+	// Handle ARN-based URIs which contain colons that would be misinterpreted as port separators.
+	// ARN examples: arn:aws:service:region:account:resource (standard), arn:aws-cn:..., arn:aws-us-gov:...
+	// We need to detect and transform the ARN to avoid URL parsing issues with colons across AWS partitions.
+	processedKey := key
+	arnValue := ""
+
+	// Check if this looks like an ARN-based URI (ARN immediately follows "://")
+	if schemeEnd := strings.Index(key, "://"); schemeEnd != -1 {
+		afterScheme := key[schemeEnd+3:]
+		if strings.HasPrefix(afterScheme, "arn:aws:") || strings.HasPrefix(afterScheme, "arn:aws-") {
+			prefix := key[:schemeEnd+3] // includes "://"
+			remainder := afterScheme
+
+			// Find where the ARN ends (at ? for query params, # for fragment, or end of string)
+			arnEnd := len(remainder)
+			if idx := strings.IndexAny(remainder, "?#"); idx != -1 {
+				arnEnd = idx
 			}
-			return nil, fmt.Errorf("no provider registered for scheme %q", scheme)
+
+			arnValue = remainder[:arnEnd]
+			suffix := remainder[arnEnd:]
+
+			// Temporarily transform to a triple-slash format so the ARN is kept in the path.
+			// This avoids net/url interpreting colons in the ARN as port separators; after parsing,
+			// we move the ARN from the path into the host field (see logic below).
+			processedKey = prefix + "/" + arnValue + suffix
+		}
+	}
+
+	uri, err := url.Parse(processedKey)
+	if err != nil {
+		return nil, err
+	}
+	// If we processed an ARN, restore it directly from the original value
+	if arnValue != "" {
+		// Use the exact ARN string captured before parsing to avoid net/url normalization/decoding.
+		uri.Host = arnValue
+		uri.Path = ""
+		uri.RawPath = ""
+	}
+
+	return uri, nil
+}
+
+// refPath returns the provider-specific path denoted by the host and the path of the uri.
+func refPath(uri *url.URL) string {
+	var components []string
+	var host string
+
+	{
+		host = uri.Host
+
+		if host != "" {
+			components = append(components, host)
+		}
+	}
+
+	{
+		path2 := uri.Path
+		path2 = strings.TrimPrefix(path2, "#")
+		if host != "" {
+			path2 = strings.TrimPrefix(path2, "/")
+		}
+
+		if path2 != "" {
+			components = append(components, path2)
 		}
 	}
 
-	updateProviders := func(uri *url.URL, hash string) (api.Provider, error) {
-		r.m.Lock()
-		defer r.m.Unlock()
-		p, ok := r.providers[hash]
+	return strings.Join(components, "/")
+}
+
+// getStringMap fetches the document at the path and caches it under mapRequestURI,
+// which is the ref without the fragment.
+func (r *Runtime) getStringMap(mapRequestURI string, p api.Provider, path string) (map[string]interface{}, error) {
+	if cachedMap, ok := r.docCache.Get(mapRequestURI); ok {
+		obj, ok := cachedMap.(map[string]interface{})
 		if !ok {
-			var scheme string
-			scheme = uri.Scheme
-			scheme = strings.Split(scheme, "://")[0]
+			return nil, fmt.Errorf("error reading map from cache: unsupported value type %T", cachedMap)
+		}
+		return obj, nil
+	}
 
-			p, err = createProvider(scheme, uri)
-			if err != nil {
-				return nil, err
-			}
+	obj, err := p.GetStringMap(path)
+	if err != nil {
+		return nil, err
+	}
+	r.docCache.Add(mapRequestURI, obj)
+
+	return obj, nil
+}
 
-			r.providers[hash] = p
+// nolint
+func (r *Runtime) lookup(key string) (interface{}, error) {
+	if val, ok := r.docCache.Get(key); ok {
+		if isTerminalValue(val) {
+			return val, nil
 		}
-		return p, nil
 	}
 
-	var only []string
-	if r.Options.ExcludeSecret {
-		only = []string{"ref"}
+	uri, err := parseRefURI(key)
+	if err != nil {
+		return nil, err
 	}
 
-	expand := expansion.ExpandRegexMatch{
-		Only:   only,
-		Target: expansion.DefaultRefRegexp,
-		Lookup: func(key string) (interface{}, error) {
-			if val, ok := r.docCache.Get(key); ok {
-				if isTerminalValue(val) {
-					return val, nil
-				}
-			}
+	p, err := r.providerFor(uri)
+	if err != nil {
+		return nil, err
+	}
 
-			// Handle ARN-based URIs which contain colons that would be misinterpreted as port separators.
-			// ARN examples: arn:aws:service:region:account:resource (standard), arn:aws-cn:..., arn:aws-us-gov:...
-			// We need to detect and transform the ARN to avoid URL parsing issues with colons across AWS partitions.
-			processedKey := key
-			arnValue := ""
-
-			// Check if this looks like an ARN-based URI (ARN immediately follows "://")
-			if schemeEnd := strings.Index(key, "://"); schemeEnd != -1 {
-				afterScheme := key[schemeEnd+3:]
-				if strings.HasPrefix(afterScheme, "arn:aws:") || strings.HasPrefix(afterScheme, "arn:aws-") {
-					prefix := key[:schemeEnd+3] // includes "://"
-					remainder := afterScheme
-
-					// Find where the ARN ends (at ? for query params, # for fragment, or end of string)
-					arnEnd := len(remainder)
-					if idx := strings.IndexAny(remainder, "?#"); idx != -1 {
-						arnEnd = idx
-					}
+	var frag string
+	frag = uri.Fragment
+	frag = strings.TrimPrefix(frag, "#")
+	frag = strings.TrimPrefix(frag, "/")
 
-					arnValue = remainder[:arnEnd]
-					suffix := remainder[arnEnd:]
+	path := refPath(uri)
 
-					// Temporarily transform to a triple-slash format so the ARN is kept in the path.
-					// This avoids net/url interpreting colons in the ARN as port separators; after parsing,
-					// we move the ARN from the path into the host field (see logic below).
-					processedKey = prefix + "/" + arnValue + suffix
-				}
+	if len(frag) == 0 {
+		var str string
+		cacheKey := key
+		if cachedStr, ok := r.strCache.Get(cacheKey); ok {
+			str, ok = cachedStr.(string)
+			if !ok {
+				return nil, fmt.Errorf("error reading str from cache: unsupported value type %T", cachedStr)
 			}
-
-			uri, err := url.Parse(processedKey)
+		} else {
+			str, err = p.GetString(path)
 			if err != nil {
 				return nil, err
 			}
-			// If we processed an ARN, restore it directly from the original value
-			if arnValue != "" {
-				// Use the exact ARN string captured before parsing to avoid net/url normalization/decoding.
-				uri.Host = arnValue
-				uri.Path = ""
-				uri.RawPath = ""
-			}
-
-			hash := uriToProviderHash(uri)
+			r.strCache.Add(cacheKey, str)
+		}
 
-			p, err := updateProviders(uri, hash)
+		return str, nil
+	} else {
+		mapRequestURI := key[:strings.LastIndex(key, uri.Fragment)-1]
+		var obj map[string]interface{}
+		if _, ok := r.docCache.Get(mapRequestURI); !ok && uri.Scheme == "httpjson" {
+			// Due to the unpredictability in the structure of the JSON object,
+			// an alternative parsing method is used here.
+			// The standard approach couldn't be applied because the JSON object
+			// may vary in its key-value pairs and nesting depth, making it difficult
+			// to reliably parse using conventional methods.
+			// This alternative approach allows for flexible handling of the JSON
+			// object, accommodating different configurations and variations.
+			value, err := p.GetString(key)
 			if err != nil {
 				return nil, err
 			}
-
-			var frag string
-			frag = uri.Fragment
-			frag = strings.TrimPrefix(frag, "#")
-			frag = strings.TrimPrefix(frag, "/")
-
-			var components []string
-			var host string
-
-			{
-				host = uri.Host
-
-				if host != "" {
-					components = append(components, host)
-				}
+			return value, nil
+		} else {
+			obj, err = r.getStringMap(mapRequestURI, p, path)
+			if err != nil {
+				return nil, err
 			}
+		}
 
-			{
-				path2 := uri.Path
-				path2 = strings.TrimPrefix(path2, "#")
-				if host != "" {
-					path2 = strings.TrimPrefix(path2, "/")
+		keys := strings.Split(frag, "/")
+		for i, k := range keys {
+			// comma-ok keeps an absent key distinct from a present null value.
+			t, found := obj[k]
+			if !found {
+				if r.Options.FailOnMissingKeyInMap {
+					return nil, fmt.Errorf("no value found for key %s", frag)
 				}
-
-				if path2 != "" {
-					components = append(components, path2)
+				return nil, nil
+			}
+			// The value at the final fragment key is the result, whatever its type.
+			if i == len(keys)-1 {
+				if isTerminalValue(t) {
+					r.docCache.Add(key, t)
 				}
+				return t, nil
 			}
+			m, ok := asStringKeyedMap(t)
+			if !ok {
+				return nil, fmt.Errorf("unexpected type of value for key at %d=%s in %v: expected a map, got %v(%T)", i, k, keys, t, t)
+			}
+			obj = m
+		}
 
-			path := strings.Join(components, "/")
-
-			if len(frag) == 0 {
-				var str string
-				cacheKey := key
-				if cachedStr, ok := r.strCache.Get(cacheKey); ok {
-					str, ok = cachedStr.(string)
-					if !ok {
-						return nil, fmt.Errorf("error reading str from cache: unsupported value type %T", cachedStr)
-					}
-				} else {
-					str, err = p.GetString(path)
-					if err != nil {
-						return nil, err
-					}
-					r.strCache.Add(cacheKey, str)
-				}
+		return nil, nil
+	}
+}
 
-				return str, nil
-			} else {
-				mapRequestURI := key[:strings.LastIndex(key, uri.Fragment)-1]
-				var obj map[string]interface{}
-				if cachedMap, ok := r.docCache.Get(mapRequestURI); ok {
-					obj, ok = cachedMap.(map[string]interface{})
-					if !ok {
-						return nil, fmt.Errorf("error reading map from cache: unsupported value type %T", cachedMap)
-					}
-				} else if uri.Scheme == "httpjson" {
-					// Due to the unpredictability in the structure of the JSON object,
-					// an alternative parsing method is used here.
-					// The standard approach couldn't be applied because the JSON object
-					// may vary in its key-value pairs and nesting depth, making it difficult
-					// to reliably parse using conventional methods.
-					// This alternative approach allows for flexible handling of the JSON
-					// object, accommodating different configurations and variations.
-					value, err := p.GetString(key)
-					if err != nil {
-						return nil, err
-					}
-					return value, nil
-				} else {
-					obj, err = p.GetStringMap(path)
-					if err != nil {
-						return nil, err
-					}
-					r.docCache.Add(mapRequestURI, obj)
-				}
+func (r *Runtime) prepare() (*expansion.ExpandRegexMatch, error) {
+	var only []string
+	if r.Options.ExcludeSecret {
+		only = []string{"ref"}
+	}
 
-				keys := strings.Split(frag, "/")
-				for i, k := range keys {
-					// comma-ok keeps an absent key distinct from a present null value.
-					t, found := obj[k]
-					if !found {
-						if r.Options.FailOnMissingKeyInMap {
-							return nil, fmt.Errorf("no value found for key %s", frag)
-						}
-						return nil, nil
-					}
-					// The value at the final fragment key is the result, whatever its type.
-					if i == len(keys)-1 {
-						if isTerminalValue(t) {
-							r.docCache.Add(key, t)
-						}
-						return t, nil
-					}
-					m, ok := asStringKeyedMap(t)
-					if !ok {
-						return nil, fmt.Errorf("unexpected type of value for key at %d=%s in %v: expected a map, got %v(%T)", i, k, keys, t, t)
-					}
-					obj = m
-				}
+	expand := expansion.ExpandRegexMatch{
+		Only:   only,
+		Target: expansion.DefaultRefRegexp,
+		Lookup: r.lookup,
+	}
 
-				return nil, nil
-			}
-		},
+	if r.Options.Recursive {
+		newRecursiveResolver(r, &expand)
 	}
 
 	return &expand, nil
@@ -401,7 +488,7 @@ func asStringKeyedMap(v any) (map[string]interface{}, bool) {
 
 // Eval replaces 'ref+<provider>://xxxxx' entries by their actual values
 func (r *Runtime) Eval(template map[string]interface{}) (map[string]interface{}, error) {
-	expand, err := r.prepare()
+	expand, err := r.prepareDocument(template)
 	if err != nil {
 		return nil, err
 	}
@@ -429,6 +516,32 @@ func (r *Runtime) Get(code string) (string, error) {
 	return ret, nil
 }
 
+// Flatten is like Get, but escapes each fetched value for the syntax surrounding
+// the expression it replaces, so that the result stays a valid document of the kind
+// denoted by escape, which is one of EscapeFormats.
+// An empty escape splices values in verbatim, exactly like Get.
+func (r *Runtime) Flatten(code string, escape string) (string, error) {
+	expand, err := r.prepare()
+	if err != nil {
+		return "", err
+	}
+
+	if escape != "" {
+		esc, err := newEscaper(escape)
+		if err != nil {
+			return "", err
+		}
+		expand.Render = esc
+	}
+
+	ret, err := expand.InString(code)
+	if err != nil {
+		return "", err
+	}
+
+	return ret, nil
+}
+
 func cloneMap(m map[string]interface{}) map[string]interface{} {
 	bs, err := yaml.Marshal(m)
 	if err != nil {
@@ -491,31 +604,46 @@ type Options struct {
 	CacheSize             int
 	ExcludeSecret         bool
 	FailOnMissingKeyInMap bool
+	// Recursive resolves the refs found in the values fetched by refs, including in the maps and lists read at fragments.
+	Recursive bool
+	// RecursionDepth limits how many levels of refs found in fetched values are resolved with Recursive,
+	// not counting the refs of the template themselves: 1 resolves the refs in the values fetched by the refs of the template,
+	// and fails on any ref in the values fetched by those, rather than leaving it unresolved. It defaults to DefaultRecursionDepth.
+	RecursionDepth int
+	// PluginDirs are searched for vals-provider-<scheme> executables, before PATH,
+	// when no provider is registered for a scheme.
+	// It defaults to the directories listed in VALS_PLUGINS_DIR.
+	PluginDirs []string
+	// Policy restricts the refs that can be resolved. A nil policy allows every ref.
+	Policy *Policy
+	// PluginPermissions are the capabilities granted to WebAssembly plugins, by scheme.
+	// They default to the ones set via VALS_PLUGIN_<SCHEME>_ALLOW_HOSTS and VALS_PLUGIN_<SCHEME>_ALLOW_ENV.
+	PluginPermissions map[string]plugin.Permissions
+	// Env customizes how Env, QuotedEnv, EnvVars and Exec turn nested maps and lists into environment variables.
+	Env EnvConfig
 }
 
 var unsafeCharRegexp = regexp.MustCompile(`[^\w@%+=:,./-]`)
 
 func env(template map[string]interface{}, quote bool, o ...Options) ([]string, error) {
-	m, err := Eval(template, o...)
+	vars, err := EnvVars(template, o...)
 	if err != nil {
 		return nil, err
 	}
-	var env []string
-	for k, v := range m {
-		switch s := v.(type) {
-		case string:
-			var value string
-			if quote && unsafeCharRegexp.MatchString(s) {
-				value = `'` + strings.ReplaceAll(s, `'`, `'"'"'`) + `'`
-			} else {
-				value = s
-			}
-			env = append(env, fmt.Sprintf("%s=%s", k, value))
-		default:
-			return nil, fmt.Errorf("unexpected type of value: %v(%T)", v, v)
+	return formatEnv(vars, quote), nil
+}
+
+// formatEnv turns the variables into KEY=value strings, like os.Environ.
+func formatEnv(vars []EnvVar, quote bool) []string {
+	env := make([]string, 0, len(vars))
+	for _, v := range vars {
+		value := v.Value
+		if quote {
+			value = quotePOSIX(v.Value)
 		}
+		env = append(env, fmt.Sprintf("%s=%s", v.Name, value))
 	}
-	return env, nil
+	return env
 }
 
 func applyEnvWithQuote(quote bool) func(map[string]interface{}, ...Options) ([]string, error) {
@@ -542,8 +670,32 @@ type ExecConfig struct {
 	StreamYAML string
 	Options    Options
 	InheritEnv bool
+	// ResolveEnv resolves the ref expressions found in the values of the inherited environment variables,
+	// like DB_PASSWORD=ref+vault://kv/db#/password, leaving the other variables untouched.
+	// It implies InheritEnv.
+	ResolveEnv bool
+	// Files maps the names of environment variables, which must be valid ones, to refs, whose values are written to files
+	// readable only by the current user, in a directory backed by memory when available.
+	// The variables are set to the paths of the files, which are removed once the command exits.
+	// They are added to the files section of the template, if any.
+	Files map[string]string
+	// WatchInterval, when positive, makes Exec resolve the refs again at this interval, bypassing caches,
+	// and apply OnChange when any value changed.
+	WatchInterval time.Duration
+	// OnChange is either ExecOnChangeRestart, the default, or ExecOnChangeSignal.
+	OnChange string
+	// ReloadSignal is sent to the command with ExecOnChangeSignal. It defaults to SIGHUP.
+	ReloadSignal os.Signal
 }
 
+const (
+	// ExecOnChangeRestart stops the command gracefully, and starts it again with the new values.
+	ExecOnChangeRestart = "restart"
+	// ExecOnChangeSignal updates the files of the command, and sends ReloadSignal to it.
+	// The command is restarted when environment variables changed, as they cannot be updated otherwise.
+	ExecOnChangeSignal = "signal"
+)
+
 func Exec(template map[string]interface{}, args []string, config ...ExecConfig) error {
 	var c ExecConfig
 	if len(config) > 0 {
@@ -563,59 +715,194 @@ func Exec(template map[string]interface{}, args []string, config ...ExecConfig)
 	if len(args) == 0 {
 		return errors.New("missing args")
 	}
-	env, err := Env(template, c.Options)
+
+	template, files := splitFiles(template)
+	for k, v := range c.Files {
+		if files == nil {
+			files = map[string]interface{}{}
+		}
+		files[k] = v
+	}
+
+	// Eval replaces refs in place, so each resolution gets its own copy to keep the refs for watching.
+	resolve := func() ([]string, map[string]string, error) {
+		return resolveExecEnv(copyMap(template), copyMap(files), c)
+	}
+
+	env, fileValues, err := resolve()
 	if err != nil {
 		return err
 	}
 
-	if c.InheritEnv {
-		env = append(os.Environ(), env...)
+	var secrets *secretFiles
+	if len(files) > 0 {
+		secrets, err = newSecretFiles()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = secrets.remove() }()
+		if err := secrets.write(fileValues); err != nil {
+			return err
+		}
 	}
 
-	cmd := exec.Command(args[0], args[1:]...)
-
+	var stdin []byte
 	if path := c.StreamYAML; path != "" {
 		buf := &bytes.Buffer{}
 
-		if err := streamYAML(path, buf, stderr); err != nil {
+		if err := streamYAML(path, buf, stderr, c.Options.Policy); err != nil {
 			return err
 		}
 
-		cmd.Stdin = buf
-	} else {
-		cmd.Stdin = os.Stdin
+		stdin = buf.Bytes()
+	}
+
+	newCmd := func(env []string) *exec.Cmd {
+		cmd := exec.Command(args[0], args[1:]...)
+
+		if stdin != nil {
+			cmd.Stdin = bytes.NewReader(stdin)
+		} else {
+			cmd.Stdin = os.Stdin
+		}
+
+		cmd.Env = append(env, secrets.env()...)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+
+		return cmd
+	}
+
+	if c.WatchInterval > 0 {
+		w := &execWatcher{
+			config:  c,
+			newCmd:  newCmd,
+			resolve: resolve,
+			secrets: secrets,
+			log:     stderr,
+		}
+		if c.Options.LogOutput != nil {
+			w.log = c.Options.LogOutput
+		}
+		return w.run(env, fileValues)
 	}
 
-	cmd.Env = env
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
+	cmd := newCmd(env)
+
+	if secrets != nil {
+		return runForwardingSignals(cmd)
+	}
 
 	return cmd.Run()
 }
 
+// resolveExecEnv resolves the environment of the command run by Exec, and the values of its files,
+// with a single runtime so that the refs to the same document fetch it once.
+func resolveExecEnv(template, files map[string]interface{}, c ExecConfig) ([]string, map[string]string, error) {
+	runtime, err := New(c.Options)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = runtime.Close() }()
+
+	vars, err := runtime.envVars(template)
+	if err != nil {
+		return nil, nil, err
+	}
+	env := formatEnv(vars, false)
+
+	if c.ResolveEnv {
+		inherited, err := resolveEnviron(os.Environ(), runtime)
+		if err != nil {
+			return nil, nil, err
+		}
+		env = append(inherited, env...)
+	} else if c.InheritEnv {
+		env = append(os.Environ(), env...)
+	}
+
+	var fileValues map[string]string
+	if len(files) > 0 {
+		fileValues, err = resolveFiles(files, runtime)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return env, fileValues, nil
+}
+
+// resolveEnviron resolves the ref expressions in the values of environ, which is formatted like os.Environ.
+func resolveEnviron(environ []string, runtime *Runtime) ([]string, error) {
+	res := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		k, v, _ := strings.Cut(kv, "=")
+		if !expansion.DefaultRefRegexp.MatchString(v) {
+			res = append(res, kv)
+			continue
+		}
+
+		resolved, err := runtime.Get(v)
+		if err != nil {
+			return nil, fmt.Errorf("resolving environment variable %s: %w", k, err)
+		}
+		res = append(res, k+"="+resolved)
+	}
+	return res, nil
+}
+
 func EvalNodes(nodes []yaml.Node, c Options) ([]yaml.Node, error) {
+	runtime, err := New(c)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = runtime.Close() }()
+	return runtime.EvalNodes(nodes)
+}
+
+// EvalNodes replaces the ref expressions in each YAML document.
+// A document whose root is a string, like the items of a list, is replaced by the value of the ref when the whole string is a ref,
+// preserving its type like Eval does for the values of maps.
+// Documents whose root is any other scalar, including empty documents, are left as is, so that the number of documents stays the same.
+func (r *Runtime) EvalNodes(nodes []yaml.Node) ([]yaml.Node, error) {
 	var res []yaml.Node
 	for _, node := range nodes {
+		if isEmptyDocument(node) {
+			res = append(res, node)
+			continue
+		}
+
 		var nodeValue interface{}
 		err := node.Decode(&nodeValue)
 		if err != nil {
 			return nil, err
 		}
 
+		expand, err := r.prepareDocument(nodeValue)
+		if err != nil {
+			return nil, err
+		}
+
 		var evalResult interface{}
 		switch v := nodeValue.(type) {
 		case map[string]interface{}:
-			evalResult, err = Eval(v, c)
+			evalResult, err = expand.InMap(v)
 			if err != nil {
 				return nil, err
 			}
 		case []interface{}:
-			evalResult, err = evalArray(v, c)
+			evalResult, err = evalArray(expand, v)
+			if err != nil {
+				return nil, err
+			}
+		case string:
+			evalResult, err = expand.InValue(v)
 			if err != nil {
 				return nil, err
 			}
 		default:
-			return nil, fmt.Errorf("unexpected type: %T", v)
+			res = append(res, node)
+			continue
 		}
 
 		err = node.Encode(evalResult)
@@ -631,18 +918,36 @@ func EvalNodes(nodes []yaml.Node, c Options) ([]yaml.Node, error) {
 	return res, nil
 }
 
-func evalArray(arr []interface{}, c Options) ([]interface{}, error) {
+// isEmptyDocument reports whether node is a document without any content, like the one between two consecutive "---" lines.
+func isEmptyDocument(node yaml.Node) bool {
+	if node.Kind != yaml.DocumentNode {
+		return false
+	}
+	if len(node.Content) == 0 {
+		return true
+	}
+	root := node.Content[0]
+	return root.Kind == yaml.ScalarNode && root.Tag == "!!null" && root.Value == ""
+}
+
+func evalArray(expand *expansion.ExpandRegexMatch, arr []interface{}) ([]interface{}, error) {
 	var res []interface{}
 	for _, item := range arr {
 		switch v := item.(type) {
 		case map[string]interface{}:
-			evalResult, err := Eval(v, c)
+			evalResult, err := expand.InMap(v)
 			if err != nil {
 				return nil, err
 			}
 			res = append(res, evalResult)
 		case []interface{}:
-			evalResult, err := evalArray(v, c)
+			evalResult, err := evalArray(expand, v)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, evalResult)
+		case string:
+			evalResult, err := expand.InValue(v)
 			if err != nil {
 				return nil, err
 			}
@@ -663,6 +968,7 @@ func Eval(template map[string]interface{}, o ...Options) (map[string]interface{}
 	if err != nil {
 		return nil, err
 	}
+	defer func() { _ = runtime.Close() }()
 	return runtime.Eval(template)
 }
 
@@ -671,9 +977,19 @@ func Get(code string, opts Options) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	defer func() { _ = runtime.Close() }()
 	return runtime.Get(code)
 }
 
+func Flatten(code string, escape string, opts Options) (string, error) {
+	runtime, err := New(opts)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = runtime.Close() }()
+	return runtime.Flatten(code, escape)
+}
+
 // nolint
 func Load(conf api.StaticConfig, opt ...Option) (map[string]interface{}, error) {
 	ctx := &ctx{}
@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -37,6 +38,145 @@ func TestExec(t *testing.T) {
 	require.Equal(t, "x: baz\n", stdout.String())
 }
 
+func TestExec_ResolveEnv(t *testing.T) {
+	t.Setenv("VALS_TEST_PASSWORD", "ref+echo://kv/db#/kv")
+	t.Setenv("VALS_TEST_URL", "https://ref+echo://example.com+/path")
+	t.Setenv("VALS_TEST_PLAIN", "ref-like but not a ref")
+
+	stdout := &bytes.Buffer{}
+
+	err := Exec(map[string]interface{}{"VALS_TEST_EXTRA": "ref+echo://extra"}, []string{"sh", "-c", `printf '%s\n' "$VALS_TEST_PASSWORD" "$VALS_TEST_URL" "$VALS_TEST_PLAIN" "$VALS_TEST_EXTRA"`}, ExecConfig{
+		Stdout:     stdout,
+		ResolveEnv: true,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, "db\nhttps://example.com/path\nref-like but not a ref\nextra\n", stdout.String())
+
+	t.Setenv("VALS_TEST_PASSWORD", "ref+echo://kv/db#/missing")
+	err = Exec(map[string]interface{}{}, []string{"true"}, ExecConfig{
+		ResolveEnv: true,
+		Options:    Options{FailOnMissingKeyInMap: true},
+	})
+	require.EqualError(t, err, "resolving environment variable VALS_TEST_PASSWORD: expand echo://kv/db#/missing: no value found for key missing")
+}
+
+func TestExec_Files(t *testing.T) {
+	stdout := &bytes.Buffer{}
+
+	template := map[string]interface{}{
+		"files": map[string]interface{}{
+			"KUBECONFIG": "ref+echo://kubeconfig",
+		},
+	}
+	script := `ls -ld "$(dirname "$KUBECONFIG")" "$KUBECONFIG" "$TLS_CERT" | cut -c1-10; cat "$KUBECONFIG" "$TLS_CERT"; echo; echo "$KUBECONFIG"`
+
+	err := Exec(template, []string{"sh", "-c", script}, ExecConfig{
+		Stdout: stdout,
+		Files:  map[string]string{"TLS_CERT": "ref+echo://cert"},
+	})
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(t, lines, 5)
+	require.Equal(t, []string{"drwx------", "-rw-------", "-rw-------", "kubeconfigcert"}, lines[:4])
+
+	// The files are removed along with their directory once the command exits.
+	_, err = os.Stat(filepath.Dir(lines[4]))
+	require.True(t, os.IsNotExist(err), "%v", err)
+
+	for _, name := range []string{"../x", "MY-FILE", "1PASSWORD", ""} {
+		err = Exec(map[string]interface{}{}, []string{"true"}, ExecConfig{
+			Files: map[string]string{name: "ref+echo://x"},
+		})
+		require.EqualError(t, err, fmt.Sprintf("invalid file name %q: must be usable as an environment variable name", name))
+	}
+}
+
+func TestExec_FilesShareRuntime(t *testing.T) {
+	dir := t.TempDir()
+	fetch := filepath.Join(dir, "fetch")
+	count := filepath.Join(dir, "count")
+	require.NoError(t, os.WriteFile(fetch, []byte("#!/bin/sh\necho >> "+count+"\nprintf 'user: u\\npassword: p\\n'\n"), 0o755))
+
+	stdout := &bytes.Buffer{}
+
+	template := map[string]interface{}{
+		"DB_USER": "ref+exec://" + fetch + "#/user",
+		"files": map[string]interface{}{
+			"DB_PASSWORD": "ref+exec://" + fetch + "#/password",
+		},
+	}
+
+	err := Exec(template, []string{"sh", "-c", `echo "$DB_USER"; cat "$DB_PASSWORD"`}, ExecConfig{Stdout: stdout})
+	require.NoError(t, err)
+	require.Equal(t, "u\np", stdout.String())
+
+	// The document is fetched once for both the variable and the file.
+	got, err := os.ReadFile(count)
+	require.NoError(t, err)
+	require.Equal(t, "\n", string(got))
+}
+
+func TestExec_Watch(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   ExecConfig
+		template func(secret string) map[string]interface{}
+		script   string
+	}{
+		{
+			name:   "restart",
+			config: ExecConfig{OnChange: ExecOnChangeRestart},
+			template: func(secret string) map[string]interface{} {
+				return map[string]interface{}{"SECRET": "ref+file://" + secret}
+			},
+			script: `echo "start $SECRET" >> "$OUT"; [ "$SECRET" = v2 ] && exit 0; while :; do sleep 0.05; done`,
+		},
+		{
+			name:   "signal",
+			config: ExecConfig{OnChange: ExecOnChangeSignal},
+			template: func(secret string) map[string]interface{} {
+				return map[string]interface{}{"files": map[string]interface{}{"SECRET": "ref+file://" + secret}}
+			},
+			script: `trap 'echo "reload $(cat "$SECRET")" >> "$OUT"; exit 0' HUP; echo "start $(cat "$SECRET")" >> "$OUT"; while :; do sleep 0.05; done`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			secret := filepath.Join(dir, "secret")
+			out := filepath.Join(dir, "out")
+			require.NoError(t, os.WriteFile(secret, []byte("v1"), 0o600))
+			t.Setenv("OUT", out)
+
+			// The secret is replaced atomically, so that it is never seen empty.
+			require.NoError(t, os.WriteFile(secret+".new", []byte("v2"), 0o600))
+			go func() {
+				time.Sleep(300 * time.Millisecond)
+				_ = os.Rename(secret+".new", secret)
+			}()
+
+			c := tc.config
+			c.InheritEnv = true
+			c.WatchInterval = 50 * time.Millisecond
+			c.Stderr = &bytes.Buffer{}
+
+			err := Exec(tc.template(secret), []string{"sh", "-c", tc.script}, c)
+			require.NoError(t, err)
+
+			got, err := os.ReadFile(out)
+			require.NoError(t, err)
+			if tc.config.OnChange == ExecOnChangeSignal {
+				require.Equal(t, "start v1\nreload v2\n", string(got))
+			} else {
+				require.Equal(t, "start v1\nstart v2\n", string(got))
+			}
+		})
+	}
+}
+
 func TestEnv(t *testing.T) {
 	input := make(map[string]interface{})
 
@@ -129,6 +269,25 @@ foo: foo/bar
 		{`bar: ref+echo://foo/bar#/foo
 foo: ref+echo://foo/bar`, `bar: bar
 foo: foo/bar
+`},
+		{`ref+echo://foo/bar
+---
+---
+- ref+echo://foo/bar#/foo
+- a: ref+echo://foo/bar
+---
+prefix-ref+echo://foo/bar#/foo
+---
+42
+`, `foo/bar
+---
+---
+- bar
+- a: foo/bar
+---
+prefix-bar
+---
+42
 `},
 	}
 
@@ -238,6 +397,73 @@ func TestFlatten(t *testing.T) {
 	}
 }
 
+func TestFlattenEscape(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(secret, []byte("it's a \"multi\"\nline $ecret\\"), 0o600))
+	ref := "ref+file://" + secret + "+"
+
+	testCases := []struct {
+		escape   string
+		input    string
+		expected string
+		err      string
+	}{
+		{
+			escape:   EscapeJSON,
+			input:    `{"key": "` + ref + `", "bare": ` + ref + `}`,
+			expected: `{"key": "it's a \"multi\"\nline $ecret\\", "bare": "it's a \"multi\"\nline $ecret\\"}`,
+		},
+		{
+			escape:   EscapeYAML,
+			input:    "a: \"" + ref + "\"\nb: " + ref + " # comment\n",
+			expected: "a: \"it's a \\\"multi\\\"\\nline $ecret\\\\\"\nb: \"it's a \\\"multi\\\"\\nline $ecret\\\\\" # comment\n",
+		},
+		{
+			escape: EscapeYAML,
+			input:  "a: '" + ref + "'\n",
+			err:    "multi-line value cannot be represented in a single-quoted YAML string",
+		},
+		{
+			escape: EscapeYAML,
+			input:  "a: prefix " + ref + "\n",
+			err:    "cannot be represented within a plain YAML scalar",
+		},
+		{
+			escape:   EscapeTOML,
+			input:    "a = \"" + ref + "\"\nb = " + ref + "\n",
+			expected: "a = \"it's a \\\"multi\\\"\\nline $ecret\\\\\"\nb = \"it's a \\\"multi\\\"\\nline $ecret\\\\\"\n",
+		},
+		{
+			escape: EscapeTOML,
+			input:  "a = '" + ref + "'\n",
+			err:    "cannot be represented in a TOML literal string",
+		},
+		{
+			escape:   EscapeShell,
+			input:    "A=" + ref + "\nB=\"" + ref + "\"\n",
+			expected: "A='it'\"'\"'s a \"multi\"\nline $ecret\\'\nB=\"it's a \\\"multi\\\"\nline \\$ecret\\\\\"\n",
+		},
+		{
+			escape:   EscapeXML,
+			input:    `<a x="` + ref + `"/>`,
+			expected: `<a x="it&#39;s a &#34;multi&#34;&#xA;line $ecret\"/>`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.escape+" "+tc.input, func(t *testing.T) {
+			got, err := Flatten(tc.input, tc.escape, Options{})
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, got)
+		})
+	}
+}
+
 func TestGetNested(t *testing.T) {
 	testCases := []struct {
 		envVars  map[string]string
@@ -461,6 +687,21 @@ string_value: It's a string
 	require.NoError(t, err)
 
 	require.Equal(t, expected, buf.String())
+
+	// The root of a document that is a single ref is replaced by the value of the ref, with its type.
+	scalarFile := createTmpFile(t, tmpDir, "scalar.yaml", replacer.Replace("{file-ref}#/nested\n---\n{file-ref}#/int\n"))
+
+	input, err = Inputs(scalarFile)
+	require.NoError(t, err)
+
+	nodes, err = EvalNodes(input, Options{})
+	require.NoError(t, err)
+	buf.Reset()
+
+	err = Output(buf, "", nodes)
+	require.NoError(t, err)
+
+	require.Equal(t, "a: 1\nb: two\n---\n42\n", buf.String())
 }
 
 type mockProvider struct {